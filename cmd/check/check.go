@@ -4,38 +4,21 @@
 package check
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io/ioutil"
 	"os"
-	"path/filepath"
-	"runtime"
 	"strings"
+	"time"
 
-	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/packer-sdk-migrator/cmd/internal/cmdutil"
+	"github.com/hashicorp/packer-sdk-migrator/migrator"
 	"github.com/hashicorp/packer-sdk-migrator/util"
 	"github.com/mitchellh/cli"
 )
 
-const (
-	CommandName = "check"
-
-	goVersionConstraint = ">=1.12"
-
-	packerModPath           = "github.com/hashicorp/packer"
-	packerVersionConstraint = ">=1.5.0"
-
-	sdkModPath           = "github.com/hashicorp/packer-plugin-sdk"
-	sdkVersionConstraint = ">=0.0.11"
-)
-
-type AlreadyMigrated struct {
-	sdkVersion string
-}
-
-func (am *AlreadyMigrated) Error() string {
-	return fmt.Sprintf("plugin already migrated to SDK version %s", am.sdkVersion)
-}
+const CommandName = "check"
 
 type command struct {
 	ui cli.Ui
@@ -48,7 +31,7 @@ func CommandFactory(ui cli.Ui) func() (cli.Command, error) {
 }
 
 func (c *command) Help() string {
-	return `Usage: packer-sdk-migrator check [--help] [PATH]
+	return `Usage: packer-sdk-migrator check [--help] [--format FORMAT] [--output FILE] [--progress MODE] [--timeout DURATION] [--sdk-version SDK_VERSION] [--rules RULES_FILE] [PATH]
 
   Checks whether the Packer plugin at PATH is ready to be migrated to the
   new Packer plugin SDK (v0.1).
@@ -56,8 +39,33 @@ func (c *command) Help() string {
   PATH is resolved relative to $GOPATH/src/PATH. If it is not supplied,
   it is assumed that the current working directory contains a Packer plugin.
 
+  Optionally, a RULES_FILE written in HCL can be passed to extend or override
+  the built-in mapping of Packer core packages to SDK packages. The mapping
+  rules for SDK_VERSION are used, defaulting to ` + util.DefaultSDKVersion + `. The
+  newest known rules are used if SDK_VERSION is a branch name, such as
+  master.
+
   By default, outputs a human-readable report and exits 0 if the plugin is
-  ready for migration, 1 otherwise.
+  ready for migration, 1 otherwise. A plugin depending on the SDK is only
+  reported as migrated already if no file imports Packer core packages
+  anymore; otherwise it is partially migrated, and migrate finishes it.
+
+  FORMAT selects the report format: text (default), csv, json, sarif or
+  junit. The json report is documented in the README. sarif emits a SARIF
+  2.1.0 log for code scanning tools, and junit a JUnit XML report with one
+  test case per constraint. --csv is a shorthand for --format csv.
+
+  With --output, the report of a structured FORMAT is written to FILE
+  instead of stdout.
+
+  MODE selects how progress is reported: text, json or quiet. The text
+  report is the progress of the check; quiet only prints its outcome. json
+  prints each check started or finished and each finding as a line of JSON.
+  Progress is only reported for structured formats if --output is passed,
+  and defaults to quiet for them.
+
+  With --timeout, the check stops once DURATION, e.g. 5m, has elapsed. This
+  bounds the time spent by ` + "`go list`" + ` downloading modules.
 
 Example:
   packer-sdk-migrator check github.com/my-packer-plugin/packer-builder-local
@@ -71,9 +79,57 @@ func (c *command) Synopsis() string {
 func (c *command) Run(args []string) int {
 	flags := flag.NewFlagSet(CommandName, flag.ExitOnError)
 	var csv bool
-	flags.BoolVar(&csv, "csv", false, "CSV output")
+	flags.BoolVar(&csv, "csv", false, "CSV output (same as --format csv)")
+	var format string
+	flags.StringVar(&format, "format", formatText, "Output format: text, csv, json, sarif or junit")
+	var sdkVersion string
+	flags.StringVar(&sdkVersion, "sdk-version", util.DefaultSDKVersion, "SDK version")
+	var rulesPath string
+	flags.StringVar(&rulesPath, "rules", "", "HCL file extending the built-in mapping rules")
+	var outputPath string
+	flags.StringVar(&outputPath, "output", "", "Write the report to a file instead of stdout")
+	var progress string
+	flags.StringVar(&progress, "progress", "", "Progress reporting: "+strings.Join(cmdutil.ProgressModes, ", "))
+	var timeout time.Duration
+	flags.DurationVar(&timeout, "timeout", 0, "Stop the check after this duration, e.g. 5m")
 	flags.Parse(args)
 
+	if csv {
+		format = formatCSV
+	}
+	if !util.StringSliceContains(formats, format) {
+		c.ui.Error(fmt.Sprintf("Unknown output format %q, expected one of: %s", format, strings.Join(formats, ", ")))
+		return cli.RunResultHelp
+	}
+	if outputPath != "" && format == formatText {
+		c.ui.Error("--output requires a structured --format")
+		return cli.RunResultHelp
+	}
+	if progress == "" {
+		progress = cmdutil.ProgressText
+		if format != formatText {
+			progress = cmdutil.ProgressQuiet
+		}
+	}
+	if progress != cmdutil.ProgressQuiet && format != formatText && outputPath == "" {
+		c.ui.Error("--progress " + progress + " requires --output with a structured --format")
+		return cli.RunResultHelp
+	}
+
+	ruleSet, err := util.LoadRules(rulesPath)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error loading rules file: %s", err))
+		return 1
+	}
+	rules, fallback, err := ruleSet.ForReference(sdkVersion)
+	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+	if fallback {
+		c.ui.Warn(fmt.Sprintf("SDK version %s is not a release version; using the newest known mapping rules", sdkVersion))
+	}
+
 	var pluginRepoName string
 	var pluginPath string
 	if flags.NArg() == 1 {
@@ -95,188 +151,55 @@ func (c *command) Run(args []string) int {
 		return cli.RunResultHelp
 	}
 
-	err := runCheck(c.ui, pluginPath, pluginRepoName, csv)
+	observer, err := cmdutil.NewObserver(progress, cmdutil.NewCheckRenderer(c.ui, pluginRepoName), pluginPath)
 	if err != nil {
-		msg, alreadyMigrated := err.(*AlreadyMigrated)
-		if alreadyMigrated {
-			c.ui.Info(msg.Error())
-			return 0
-		}
-
-		if !csv {
-			c.ui.Error(err.Error())
-		}
-		return 1
-	}
-
-	return 0
-}
-
-func RunCheck(ui cli.Ui, pluginPath, repoName string) error {
-	return runCheck(ui, pluginPath, repoName, false)
-}
-
-func runCheck(ui cli.Ui, pluginPath, repoName string, csv bool) error {
-	if !csv {
-		ui.Output("Checking Go runtime version ...")
-	}
-	goVersion, goVersionSatisfied := CheckGoVersion(pluginPath)
-	if !csv {
-		if goVersionSatisfied {
-			ui.Info(fmt.Sprintf("Go version %s: OK.", goVersion))
-		} else {
-			ui.Warn(fmt.Sprintf("Go version does not satisfy constraint %s. Found Go version: %s.", goVersionConstraint, goVersion))
-		}
-	}
-
-	if !csv {
-		ui.Output("Checking whether plugin uses Go modules...")
-	}
-	goModulesUsed := CheckForGoModules(pluginPath)
-	if !csv {
-		if goModulesUsed {
-			ui.Info("Go modules in use: OK.")
-		} else {
-			ui.Warn("Go modules not in use. plugin must use Go modules.")
-		}
-	}
-
-	if !csv {
-		ui.Output(fmt.Sprintf("Checking version of %s to determine if plugin was already migrated...", sdkModPath))
+		c.ui.Error(err.Error())
+		return cli.RunResultHelp
 	}
-	sdkVersion, sdkVersionSatisfied, err := CheckDependencyVersion(pluginPath, sdkModPath, sdkVersionConstraint)
+	ctx, cancel := cmdutil.NewContext(timeout)
+	defer cancel()
+	result, err := migrator.Check(ctx, migrator.Options{
+		PluginPath: pluginPath,
+		Rules:      rules,
+		Observer:   observer,
+	})
 	if err != nil {
-		return fmt.Errorf("Error getting SDK version for plugin %s: %s", pluginPath, err)
-	}
-	if !csv {
-		if sdkVersionSatisfied {
-			return &AlreadyMigrated{sdkVersion}
-		} else if sdkVersion != "" {
-			return fmt.Errorf("plugin already migrated, but SDK version %s does not satisfy constraint %s.",
-				sdkVersion, sdkVersionConstraint)
-		}
+		c.ui.Error(cmdutil.DescribeErr(err, timeout))
+		return 1
 	}
 
-	if !csv {
-		ui.Output(fmt.Sprintf("Checking version of %s used in plugin...", packerModPath))
-	}
-	packerVersion, packerVersionSatisfied, err := CheckDependencyVersion(pluginPath, packerModPath, packerVersionConstraint)
-	if err != nil {
-		return fmt.Errorf("Error getting Packer version for plugin %s: %s", pluginPath, err)
-	}
-	if !csv {
-		if packerVersionSatisfied {
-			ui.Info(fmt.Sprintf("Packer version %s: OK.", packerVersion))
-		} else if packerVersion != "" {
-			ui.Warn(fmt.Sprintf("Packer version does not satisfy constraint %s. Found Packer version: %s", packerVersionConstraint, packerVersion))
-		} else {
-			return fmt.Errorf("This directory (%s) doesn't seem to be a Packer plugin.\nplugins depend on %s", pluginPath, packerModPath)
+	if format != formatText {
+		out, err := newCheckResult(result).render(format)
+		if err == nil && outputPath != "" {
+			err = ioutil.WriteFile(outputPath, append(out, '\n'), 0644)
+		} else if err == nil {
+			c.ui.Output(string(out))
 		}
-	}
-
-	if !csv {
-		ui.Output("Checking whether plugin uses deprecated SDK packages or identifiers...")
-	}
-	removedPackagesInUse, removedIdentsInUse, err := CheckSDKPackageImportsAndRefs(pluginPath)
-	if err != nil {
-		return err
-	}
-	usesRemovedPackagesOrIdents := len(removedPackagesInUse) > 0 || len(removedIdentsInUse) > 0
-	if !csv {
 		if err != nil {
-			return fmt.Errorf("Error determining use of deprecated SDK packages and identifiers: %s", err)
-		}
-		if !usesRemovedPackagesOrIdents {
-			ui.Info("No imports of deprecated SDK packages or identifiers: OK.")
-		}
-		formatRemovedPackages(ui, removedPackagesInUse)
-		formatRemovedIdents(ui, removedIdentsInUse)
-	}
-	constraintsSatisfied := goVersionSatisfied && goModulesUsed && packerVersionSatisfied && !usesRemovedPackagesOrIdents
-	if csv {
-		ui.Output(fmt.Sprintf("go_version,go_version_satisfies_constraint,uses_go_modules,sdk_version,sdk_version_satisfies_constraint,does_not_use_removed_packages,all_constraints_satisfied\n%s,%t,%t,%s,%t,%t,%t",
-			goVersion, goVersionSatisfied, goModulesUsed, packerVersion, packerVersionSatisfied, !usesRemovedPackagesOrIdents, constraintsSatisfied))
-	} else {
-		var prettypluginName string
-		if repoName != "" {
-			prettypluginName = " " + repoName
-		}
-		if constraintsSatisfied {
-			ui.Info(fmt.Sprintf("\nAll constraints satisfied. plugin%s can be migrated to the new SDK.\n", prettypluginName))
-			return nil
-		} else if goModulesUsed && packerVersionSatisfied && !usesRemovedPackagesOrIdents {
-			ui.Info(fmt.Sprintf("\nplugin%s can be migrated to the new SDK, but Go version %s is recommended.\n", prettypluginName, goVersionConstraint))
-			return nil
-		}
-	}
-
-	return fmt.Errorf("\nSome constraints not satisfied. Please resolve these before migrating to the new SDK.")
-}
-
-func formatRemovedPackages(ui cli.Ui, removedPackagesInUse []string) {
-	if len(removedPackagesInUse) == 0 {
-		return
-	}
-
-	ui.Warn("Deprecated SDK packages in use:")
-	for _, pkg := range removedPackagesInUse {
-		ui.Warn(fmt.Sprintf(" * %s", pkg))
-	}
-}
-
-func formatRemovedIdents(ui cli.Ui, removedIdentsInUse []*Offence) {
-	if len(removedIdentsInUse) == 0 {
-		return
-	}
-	ui.Warn("Deprecated SDK identifiers in use:")
-	for _, ident := range removedIdentsInUse {
-		d := ident.IdentDeprecation
-		ui.Warn(fmt.Sprintf(" * %s (%s)", d.Identifier.Name, d.ImportPath))
-
-		for _, pos := range ident.Positions {
-			ui.Warn(fmt.Sprintf("   * %s", pos))
+			c.ui.Error(fmt.Sprintf("Error writing report: %s", err))
+			return 1
 		}
 	}
-}
-
-func CheckGoVersion(pluginPath string) (goVersion string, satisfiesConstraint bool) {
-	c, err := version.NewConstraint(goVersionConstraint)
-
-	runtimeVersion := strings.TrimLeft(runtime.Version(), "go")
-	v, err := version.NewVersion(runtimeVersion)
-	if err != nil {
-		log.Printf("[WARN] Could not parse Go version %s", runtimeVersion)
-		return "", false
-	}
-
-	return runtimeVersion, c.Check(v)
-}
 
-func CheckForGoModules(pluginPath string) (usingModules bool) {
-	if _, err := os.Stat(filepath.Join(pluginPath, "go.mod")); err != nil {
-		log.Printf("[WARN] 'go.mod' file not found - plugin %s is not using Go modules", pluginPath)
-		return false
+	err = result.Err()
+	var alreadyMigrated *migrator.AlreadyMigrated
+	switch {
+	case format != formatText:
+		// The structured reports tell why the plugin is not ready.
+	case errors.As(err, &alreadyMigrated):
+		c.ui.Info(err.Error())
+	case err != nil:
+		c.ui.Error(err.Error())
 	}
-	return true
+	return exitStatus(err)
 }
 
-func CheckSDKPackageImportsAndRefs(pluginPath string) (removedPackagesInUse []string, packageRefsOffences []*Offence, err error) {
-	var pluginImportDetails *pluginImportDetails
-
-	pluginImportDetails, err = GoListPackageImports(pluginPath)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	removedPackagesInUse, err = CheckSDKPackageImports(pluginImportDetails)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	packageRefsOffences, err = CheckSDKPackageRefs(pluginImportDetails)
-	if err != nil {
-		return nil, nil, err
+// exitStatus returns the exit status of a check which found err: 0 if the
+// plugin can be migrated or was already migrated, 1 otherwise.
+func exitStatus(err error) int {
+	var alreadyMigrated *migrator.AlreadyMigrated
+	if err == nil || errors.As(err, &alreadyMigrated) {
+		return 0
 	}
-
-	return
+	return 1
 }
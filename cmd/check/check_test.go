@@ -0,0 +1,49 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package check
+
+import (
+	"testing"
+
+	"github.com/hashicorp/packer-sdk-migrator/migrator"
+)
+
+func versionCheck(v, constraint string, satisfied bool) migrator.VersionCheck {
+	return migrator.VersionCheck{Version: v, Constraint: constraint, Satisfied: satisfied}
+}
+
+func Test_exitStatus(t *testing.T) {
+	migratable := func() *migrator.CheckResult {
+		return &migrator.CheckResult{
+			GoVersion:     versionCheck("1.15.6", migrator.GoVersionConstraint, true),
+			GoModulesUsed: true,
+			SDKVersion:    versionCheck("", migrator.SDKVersionConstraint, false),
+			PackerVersion: versionCheck("1.6.5", migrator.PackerVersionConstraint, true),
+		}
+	}
+	alreadyMigrated := migratable()
+	alreadyMigrated.SDKVersion = versionCheck("0.0.14", migrator.SDKVersionConstraint, true)
+	alreadyMigrated.AlreadyMigrated = true
+	oldSDK := migratable()
+	oldSDK.SDKVersion = versionCheck("0.0.5", migrator.SDKVersionConstraint, false)
+	noModules := migratable()
+	noModules.GoModulesUsed = false
+
+	tc := map[string]struct {
+		result *migrator.CheckResult
+		status int
+	}{
+		"migratable":       {migratable(), 0},
+		"already migrated": {alreadyMigrated, 0},
+		"old SDK":          {oldSDK, 1},
+		"no Go modules":    {noModules, 1},
+	}
+	for name, tc := range tc {
+		t.Run(name, func(t *testing.T) {
+			if status := exitStatus(tc.result.Err()); status != tc.status {
+				t.Fatalf("expected exit status %d, got %d", tc.status, status)
+			}
+		})
+	}
+}
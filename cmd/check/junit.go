@@ -0,0 +1,190 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package check
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-sdk-migrator/migrator"
+)
+
+const junitClassName = "packer-sdk-migrator.check"
+
+type junitTestSuites struct {
+	XMLName xml.Name          `xml:"testsuites"`
+	Suites  []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Properties []*junitProperty `xml:"properties>property"`
+	TestCases  []*junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",cdata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// JUnit renders every constraint of the check as a JUnit test case. Unmet
+// hard constraints are failures. The Go version is only a recommendation, so
+// it is reported as skipped when not satisfied. Once a plugin is found to be
+// already migrated, the remaining constraints are skipped.
+func (r *checkResult) JUnit() ([]byte, error) {
+	cases := []*junitTestCase{
+		r.goVersionCase(),
+		r.goModulesCase(),
+		r.sdkVersionCase(),
+	}
+	if r.AlreadyMigrated {
+		reason := fmt.Sprintf("plugin already migrated to SDK version %s", r.SDKVersion.Version)
+		for _, name := range []string{"Packer version", "Deprecated packages", "Deprecated identifiers"} {
+			cases = append(cases, skippedCase(name, reason))
+		}
+	} else {
+		cases = append(cases, r.packerVersionCase(), r.removedPackagesCase(), r.deprecatedIdentifiersCase())
+	}
+
+	suite := &junitTestSuite{
+		Name:  r.PluginPath,
+		Tests: len(cases),
+		Properties: []*junitProperty{
+			{"go_version", r.GoVersion.Version},
+			{"sdk_version", r.SDKVersion.Version},
+			{"packer_version", r.PackerVersion.Version},
+		},
+		TestCases: cases,
+	}
+	for _, c := range cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+		if c.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+
+	out, err := xml.MarshalIndent(&junitTestSuites{Suites: []*junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func (r *checkResult) goVersionCase() *junitTestCase {
+	v := r.GoVersion
+	if !v.Satisfied {
+		return skippedCase("Go version", fmt.Sprintf("Go version %s is recommended. Found Go version: %s.", v.Constraint, v.Version))
+	}
+	return passedCase("Go version")
+}
+
+func (r *checkResult) goModulesCase() *junitTestCase {
+	if !r.GoModulesUsed {
+		return failedCase("Go modules", "Go modules not in use. plugin must use Go modules.", "")
+	}
+	return passedCase("Go modules")
+}
+
+func (r *checkResult) sdkVersionCase() *junitTestCase {
+	v := r.SDKVersion
+	if v.Version != "" && !v.Satisfied {
+		return failedCase("SDK already migrated",
+			fmt.Sprintf("plugin already migrated, but SDK version %s does not satisfy constraint %s.", v.Version, v.Constraint), "")
+	}
+	return passedCase("SDK already migrated")
+}
+
+func (r *checkResult) packerVersionCase() *junitTestCase {
+	v := r.PackerVersion
+	if r.PartiallyMigrated {
+		return skippedCase("Packer version", fmt.Sprintf("plugin partially migrated to SDK version %s", r.SDKVersion.Version))
+	}
+	if v.Version == "" {
+		return failedCase("Packer version", fmt.Sprintf("plugin does not depend on %s.", migrator.PackerModPath), "")
+	}
+	if !v.Satisfied {
+		return failedCase("Packer version",
+			fmt.Sprintf("Packer version does not satisfy constraint %s. Found Packer version: %s", v.Constraint, v.Version), "")
+	}
+	return passedCase("Packer version")
+}
+
+func (r *checkResult) removedPackagesCase() *junitTestCase {
+	if len(r.RemovedPackages) == 0 {
+		return passedCase("Deprecated packages")
+	}
+
+	var body strings.Builder
+	for _, pkg := range r.RemovedPackages {
+		fmt.Fprintf(&body, "%s\n", pkg.ImportPath)
+		for _, pos := range pkg.Positions {
+			fmt.Fprintf(&body, "  %s:%d:%d\n", pos.Filename, pos.Line, pos.Column)
+		}
+	}
+	return failedCase("Deprecated packages",
+		fmt.Sprintf("%d deprecated SDK package(s) in use", len(r.RemovedPackages)), body.String())
+}
+
+func (r *checkResult) deprecatedIdentifiersCase() *junitTestCase {
+	if len(r.DeprecatedIdentifiers) == 0 {
+		return passedCase("Deprecated identifiers")
+	}
+
+	var body strings.Builder
+	for _, ident := range r.DeprecatedIdentifiers {
+		fmt.Fprintf(&body, "%s (%s)", ident.Identifier, ident.ImportPath)
+		if ident.Message != "" {
+			fmt.Fprintf(&body, ": %s", ident.Message)
+		}
+		body.WriteString("\n")
+		if ident.Replacement != "" {
+			fmt.Fprintf(&body, "  suggested replacement: %s\n", ident.Replacement)
+		}
+		for _, pos := range ident.Positions {
+			fmt.Fprintf(&body, "  %s:%d:%d\n", pos.Filename, pos.Line, pos.Column)
+		}
+	}
+	return failedCase("Deprecated identifiers",
+		fmt.Sprintf("%d deprecated SDK identifier(s) in use", len(r.DeprecatedIdentifiers)), body.String())
+}
+
+func passedCase(name string) *junitTestCase {
+	return &junitTestCase{ClassName: junitClassName, Name: name}
+}
+
+func failedCase(name, message, body string) *junitTestCase {
+	c := passedCase(name)
+	c.Failure = &junitFailure{Message: message, Type: "ConstraintNotSatisfied", Body: body}
+	return c
+}
+
+func skippedCase(name, message string) *junitTestCase {
+	c := passedCase(name)
+	c.Skipped = &junitSkipped{Message: message}
+	return c
+}
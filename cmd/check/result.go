@@ -0,0 +1,230 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package check
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"path/filepath"
+
+	"github.com/hashicorp/packer-sdk-migrator/migrator"
+)
+
+const (
+	formatText  = "text"
+	formatCSV   = "csv"
+	formatJSON  = "json"
+	formatSARIF = "sarif"
+	formatJUnit = "junit"
+
+	// resultFormatVersion is bumped whenever a field of the structured
+	// report is changed or removed.
+	resultFormatVersion = 1
+)
+
+var formats = []string{formatText, formatCSV, formatJSON, formatSARIF, formatJUnit}
+
+// checkResult is the structured report of a check, as documented in the
+// README. File names are relative to the plugin directory.
+type checkResult struct {
+	FormatVersion           int                  `json:"format_version"`
+	PluginPath              string               `json:"plugin_path"`
+	GoVersion               versionResult        `json:"go_version"`
+	GoModulesUsed           bool                 `json:"go_modules_used"`
+	SDKVersion              versionResult        `json:"sdk_version"`
+	AlreadyMigrated         bool                 `json:"already_migrated"`
+	PartiallyMigrated       bool                 `json:"partially_migrated"`
+	Stragglers              []*stragglerResult   `json:"stragglers"`
+	MigrationInProgress     bool                 `json:"migration_in_progress"`
+	PackerVersion           versionResult        `json:"packer_version"`
+	CorePackages            []*corePackageResult `json:"core_packages"`
+	RemovedPackages         []*packageResult     `json:"removed_packages"`
+	DeprecatedIdentifiers   []*identifierResult  `json:"deprecated_identifiers"`
+	AllConstraintsSatisfied bool                 `json:"all_constraints_satisfied"`
+}
+
+type versionResult struct {
+	Version    string `json:"version"`
+	Constraint string `json:"constraint"`
+	Satisfied  bool   `json:"satisfied"`
+}
+
+type packageResult struct {
+	ImportPath string            `json:"import_path"`
+	Files      []string          `json:"files"`
+	Positions  []*positionResult `json:"positions"`
+}
+
+// stragglerResult is a file still importing Packer core packages.
+type stragglerResult struct {
+	Filename     string   `json:"filename"`
+	Status       string   `json:"status"`
+	CorePackages []string `json:"core_packages"`
+}
+
+type corePackageResult struct {
+	ImportPath string   `json:"import_path"`
+	Status     string   `json:"status"`
+	Targets    []string `json:"targets"`
+}
+
+// packageStatuses are the values of the status of core packages.
+var packageStatuses = map[migrator.PackageStatus]string{
+	migrator.PackageMapped:  "mapped",
+	migrator.PackageSplit:   "split",
+	migrator.PackageRemoved: "removed",
+}
+
+type identifierResult struct {
+	Identifier  string            `json:"identifier"`
+	ImportPath  string            `json:"import_path"`
+	Message     string            `json:"message"`
+	Replacement string            `json:"replacement"`
+	Positions   []*positionResult `json:"positions"`
+}
+
+type positionResult struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int    `json:"offset"`
+}
+
+// newCheckResult returns the structured report of the result of a check.
+func newCheckResult(result *migrator.CheckResult) *checkResult {
+	r := &checkResult{
+		FormatVersion:           resultFormatVersion,
+		PluginPath:              result.PluginPath,
+		GoVersion:               versionResult(result.GoVersion),
+		GoModulesUsed:           result.GoModulesUsed,
+		SDKVersion:              versionResult(result.SDKVersion),
+		AlreadyMigrated:         result.AlreadyMigrated,
+		PartiallyMigrated:       result.PartiallyMigrated,
+		MigrationInProgress:     result.Journal != nil,
+		PackerVersion:           versionResult(result.PackerVersion),
+		AllConstraintsSatisfied: result.AllConstraintsSatisfied(),
+	}
+	r.setFindings(result.CorePackages, result.DeprecatedIdentifiers)
+	r.setStragglers(result.Stragglers())
+	return r
+}
+
+func (r *checkResult) setStragglers(files []*migrator.FileMigration) {
+	r.Stragglers = []*stragglerResult{}
+	for _, f := range files {
+		r.Stragglers = append(r.Stragglers, &stragglerResult{
+			Filename:     r.relPath(f.Path),
+			Status:       string(f.Status),
+			CorePackages: f.CorePackages,
+		})
+	}
+}
+
+func (r *checkResult) setFindings(corePackages []*migrator.CorePackage, offences []*migrator.Offence) {
+	r.CorePackages = []*corePackageResult{}
+	for _, pkg := range corePackages {
+		targets := pkg.Targets
+		if targets == nil {
+			targets = []string{}
+		}
+		r.CorePackages = append(r.CorePackages, &corePackageResult{
+			ImportPath: pkg.ImportPath,
+			Status:     packageStatuses[pkg.Status],
+			Targets:    targets,
+		})
+	}
+
+	r.RemovedPackages = []*packageResult{}
+	for _, pkg := range corePackages {
+		if pkg.Status != migrator.PackageRemoved {
+			continue
+		}
+		pr := &packageResult{
+			ImportPath: pkg.ImportPath,
+			Files:      []string{},
+			Positions:  []*positionResult{},
+		}
+		for _, f := range pkg.Files {
+			pr.Files = append(pr.Files, r.relPath(f))
+		}
+		for _, pos := range pkg.Positions {
+			pr.Positions = append(pr.Positions, r.position(pos))
+		}
+		r.RemovedPackages = append(r.RemovedPackages, pr)
+	}
+
+	r.DeprecatedIdentifiers = []*identifierResult{}
+	for _, o := range offences {
+		d := o.IdentDeprecation
+		ir := &identifierResult{
+			Identifier:  d.Identifier.Name,
+			ImportPath:  d.ImportPath,
+			Message:     d.Message,
+			Replacement: d.Replacement,
+			Positions:   []*positionResult{},
+		}
+		for _, pos := range o.Positions {
+			ir.Positions = append(ir.Positions, r.position(pos))
+		}
+		r.DeprecatedIdentifiers = append(r.DeprecatedIdentifiers, ir)
+	}
+}
+
+func (r *checkResult) position(pos *token.Position) *positionResult {
+	return &positionResult{
+		Filename: r.relPath(pos.Filename),
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Offset:   pos.Offset,
+	}
+}
+
+func (r *checkResult) relPath(path string) string {
+	rel, err := filepath.Rel(r.PluginPath, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// render renders the result in one of the structured formats.
+func (r *checkResult) render(format string) ([]byte, error) {
+	switch format {
+	case formatCSV:
+		return r.CSV(), nil
+	case formatJSON:
+		return r.JSON()
+	case formatSARIF:
+		return r.SARIF()
+	case formatJUnit:
+		return r.JUnit()
+	}
+	return nil, fmt.Errorf("unsupported report format %q", format)
+}
+
+// CSV renders the result as a header and a single row of results.
+func (r *checkResult) CSV() []byte {
+	usesRemovedPackagesOrIdents := len(r.RemovedPackages) > 0 || len(r.DeprecatedIdentifiers) > 0
+	return []byte(fmt.Sprintf("go_version,go_version_satisfies_constraint,uses_go_modules,sdk_version,sdk_version_satisfies_constraint,does_not_use_removed_packages,all_constraints_satisfied\n%s,%t,%t,%s,%t,%t,%t",
+		r.GoVersion.Version, r.GoVersion.Satisfied, r.GoModulesUsed, r.PackerVersion.Version, r.PackerVersion.Satisfied, !usesRemovedPackagesOrIdents, r.AllConstraintsSatisfied))
+}
+
+func (r *checkResult) JSON() ([]byte, error) {
+	return marshalReport(r)
+}
+
+// marshalReport encodes v as indented JSON. Unlike json.MarshalIndent, it
+// leaves characters such as < and > in version constraints unescaped.
+func marshalReport(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
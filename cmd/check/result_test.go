@@ -0,0 +1,262 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package check
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/packer-sdk-migrator/migrator"
+)
+
+const testPluginPath = "/src/plugin"
+
+func testCheckResult() *checkResult {
+	pluginPath := filepath.FromSlash(testPluginPath)
+	r := &checkResult{
+		FormatVersion:   resultFormatVersion,
+		PluginPath:      pluginPath,
+		GoVersion:       versionResult{"1.15.6", migrator.GoVersionConstraint, true},
+		GoModulesUsed:   true,
+		SDKVersion:      versionResult{"", migrator.SDKVersionConstraint, false},
+		PackerVersion:   versionResult{"1.6.5", migrator.PackerVersionConstraint, true},
+		AlreadyMigrated: false,
+	}
+	r.setStragglers([]*migrator.FileMigration{{
+		Path:         filepath.Join(pluginPath, "main.go"),
+		Status:       migrator.FileCoreOnly,
+		CorePackages: []string{"github.com/hashicorp/packer/version"},
+	}})
+	r.setFindings(
+		[]*migrator.CorePackage{{
+			ImportPath: "github.com/hashicorp/packer/common",
+			Status:     migrator.PackageSplit,
+			Targets: []string{
+				"github.com/hashicorp/packer-plugin-sdk/common",
+				"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps",
+			},
+		}, {
+			ImportPath: "github.com/hashicorp/packer/version",
+			Status:     migrator.PackageRemoved,
+			Files:      []string{filepath.Join(pluginPath, "main.go")},
+			Positions: []*token.Position{{
+				Filename: filepath.Join(pluginPath, "main.go"),
+				Offset:   40,
+				Line:     5,
+				Column:   2,
+			}},
+		}},
+		[]*migrator.Offence{{
+			IdentDeprecation: &migrator.IdentDeprecation{
+				ImportPath:  "github.com/hashicorp/packer/common",
+				Identifier:  ast.NewIdent("Retry"),
+				Message:     "Use the retry package instead",
+				Replacement: "retry.Config{}.Run(ctx, fn)",
+			},
+			Positions: []*token.Position{{
+				Filename: filepath.Join(pluginPath, "builder", "step.go"),
+				Offset:   120,
+				Line:     10,
+				Column:   3,
+			}},
+		}},
+	)
+	return r
+}
+
+func Test_checkResult_JSON(t *testing.T) {
+	r := testCheckResult()
+	expected := `{
+  "format_version": 1,
+  "plugin_path": "` + filepath.FromSlash(testPluginPath) + `",
+  "go_version": {
+    "version": "1.15.6",
+    "constraint": ">=1.12",
+    "satisfied": true
+  },
+  "go_modules_used": true,
+  "sdk_version": {
+    "version": "",
+    "constraint": ">=0.0.11",
+    "satisfied": false
+  },
+  "already_migrated": false,
+  "partially_migrated": false,
+  "stragglers": [
+    {
+      "filename": "main.go",
+      "status": "core-only",
+      "core_packages": [
+        "github.com/hashicorp/packer/version"
+      ]
+    }
+  ],
+  "migration_in_progress": false,
+  "packer_version": {
+    "version": "1.6.5",
+    "constraint": ">=1.5.0",
+    "satisfied": true
+  },
+  "core_packages": [
+    {
+      "import_path": "github.com/hashicorp/packer/common",
+      "status": "split",
+      "targets": [
+        "github.com/hashicorp/packer-plugin-sdk/common",
+        "github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+      ]
+    },
+    {
+      "import_path": "github.com/hashicorp/packer/version",
+      "status": "removed",
+      "targets": []
+    }
+  ],
+  "removed_packages": [
+    {
+      "import_path": "github.com/hashicorp/packer/version",
+      "files": [
+        "main.go"
+      ],
+      "positions": [
+        {
+          "filename": "main.go",
+          "line": 5,
+          "column": 2,
+          "offset": 40
+        }
+      ]
+    }
+  ],
+  "deprecated_identifiers": [
+    {
+      "identifier": "Retry",
+      "import_path": "github.com/hashicorp/packer/common",
+      "message": "Use the retry package instead",
+      "replacement": "retry.Config{}.Run(ctx, fn)",
+      "positions": [
+        {
+          "filename": "builder/step.go",
+          "line": 10,
+          "column": 3,
+          "offset": 120
+        }
+      ]
+    }
+  ],
+  "all_constraints_satisfied": false
+}`
+
+	actual, err := r.JSON()
+	if err != nil {
+		t.Fatalf("JSON: %s", err)
+	}
+	if diff := cmp.Diff(expected, string(actual)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+}
+
+func Test_checkResult_SARIF(t *testing.T) {
+	out, err := testCheckResult().SARIF()
+	if err != nil {
+		t.Fatalf("SARIF: %s", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(out, &log); err != nil {
+		t.Fatalf("invalid SARIF log: %s", err)
+	}
+	if log.Version != sarifVersion || len(log.Runs) != 1 {
+		t.Fatalf("unexpected SARIF log: %s", out)
+	}
+
+	run := log.Runs[0]
+	if got := run.OriginalURIBaseIDs[sarifRootBaseID].URI; got != "file:///src/plugin/" {
+		t.Fatalf("unexpected root URI %q", got)
+	}
+
+	expected := []*sarifResult{
+		{
+			RuleID:    ruleRemovedPackage,
+			RuleIndex: 0,
+			Level:     "error",
+			Message:   sarifMessage{"Package github.com/hashicorp/packer/version has no equivalent in github.com/hashicorp/packer-plugin-sdk."},
+			Locations: []*sarifLocation{{sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactURI{"main.go", sarifRootBaseID},
+				Region:           sarifRegion{5, 2, 5, 39},
+			}}},
+		},
+		{
+			RuleID:    ruleDeprecatedIdentifier,
+			RuleIndex: 1,
+			Level:     "error",
+			Message:   sarifMessage{"Use the retry package instead Suggested replacement: retry.Config{}.Run(ctx, fn)"},
+			Locations: []*sarifLocation{{sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactURI{"builder/step.go", sarifRootBaseID},
+				Region:           sarifRegion{10, 3, 10, 8},
+			}}},
+		},
+	}
+	if diff := cmp.Diff(expected, run.Results); diff != "" {
+		t.Fatalf("unexpected results: %s", diff)
+	}
+}
+
+func Test_checkResult_JUnit(t *testing.T) {
+	out, err := testCheckResult().JUnit()
+	if err != nil {
+		t.Fatalf("JUnit: %s", err)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(out, &report); err != nil {
+		t.Fatalf("invalid JUnit report: %s", err)
+	}
+	if len(report.Suites) != 1 {
+		t.Fatalf("expected 1 test suite, got %d", len(report.Suites))
+	}
+	suite := report.Suites[0]
+	if suite.Tests != 6 || suite.Failures != 2 || suite.Skipped != 0 {
+		t.Fatalf("unexpected counts: %d tests, %d failures, %d skipped", suite.Tests, suite.Failures, suite.Skipped)
+	}
+
+	failures := map[string]string{}
+	for _, c := range suite.TestCases {
+		if c.Failure != nil {
+			failures[c.Name] = c.Failure.Body
+		}
+	}
+	expected := map[string]string{
+		"Deprecated packages":    "github.com/hashicorp/packer/version\n  main.go:5:2\n",
+		"Deprecated identifiers": "Retry (github.com/hashicorp/packer/common): Use the retry package instead\n  suggested replacement: retry.Config{}.Run(ctx, fn)\n  builder/step.go:10:3\n",
+	}
+	if diff := cmp.Diff(expected, failures); diff != "" {
+		t.Fatalf("unexpected failures: %s", diff)
+	}
+}
+
+func Test_checkResult_JUnit_alreadyMigrated(t *testing.T) {
+	r := testCheckResult()
+	r.SDKVersion = versionResult{"0.0.14", migrator.SDKVersionConstraint, true}
+	r.AlreadyMigrated = true
+
+	out, err := r.JUnit()
+	if err != nil {
+		t.Fatalf("JUnit: %s", err)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(out, &report); err != nil {
+		t.Fatalf("invalid JUnit report: %s", err)
+	}
+	suite := report.Suites[0]
+	if suite.Failures != 0 || suite.Skipped != 3 {
+		t.Fatalf("unexpected counts: %d failures, %d skipped", suite.Failures, suite.Skipped)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package check
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-sdk-migrator/migrator"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json"
+
+	// sarifRootBaseID is the base all artifact locations are relative to. It
+	// resolves to the plugin directory.
+	sarifRootBaseID = "PLUGINROOT"
+
+	ruleRemovedPackage       = "removed-package"
+	ruleDeprecatedIdentifier = "deprecated-identifier"
+)
+
+var sarifRules = []*sarifRule{
+	{
+		ID:               ruleRemovedPackage,
+		Name:             "RemovedPackage",
+		ShortDescription: sarifMessage{"Package not available in the Packer plugin SDK"},
+		FullDescription: sarifMessage{"The plugin imports a package of " + migrator.PackerModPath +
+			" which has no equivalent in " + migrator.SDKModPath + ". Its use must be removed before migrating."},
+		HelpURI: "https://github.com/hashicorp/packer-sdk-migrator#packer-sdk-migrator-check-check-eligibility-for-migration",
+	},
+	{
+		ID:               ruleDeprecatedIdentifier,
+		Name:             "DeprecatedIdentifier",
+		ShortDescription: sarifMessage{"Identifier not available in the Packer plugin SDK"},
+		FullDescription: sarifMessage{"The plugin refers to an identifier which was removed from " + migrator.SDKModPath +
+			". Its use must be replaced before migrating."},
+		HelpURI: "https://github.com/hashicorp/packer-sdk-migrator#packer-sdk-migrator-check-check-eligibility-for-migration",
+	},
+}
+
+type sarifLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                    `json:"tool"`
+	OriginalURIBaseIDs map[string]*sarifArtifactURI `json:"originalUriBaseIds"`
+	Results            []*sarifResult               `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+	HelpURI          string       `json:"helpUri"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string           `json:"ruleId"`
+	RuleIndex int              `json:"ruleIndex"`
+	Level     string           `json:"level"`
+	Message   sarifMessage     `json:"message"`
+	Locations []*sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactURI `json:"artifactLocation"`
+	Region           sarifRegion      `json:"region"`
+}
+
+type sarifArtifactURI struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// SARIF converts the findings of the check into a SARIF 2.1.0 log with one
+// result per reference to a removed package or identifier.
+func (r *checkResult) SARIF() ([]byte, error) {
+	results := []*sarifResult{}
+
+	for _, pkg := range r.RemovedPackages {
+		// Import paths are reported including their quotes.
+		width := len(pkg.ImportPath) + 2
+		msg := fmt.Sprintf("Package %s has no equivalent in %s.", pkg.ImportPath, migrator.SDKModPath)
+		for _, pos := range pkg.Positions {
+			results = append(results, newSARIFResult(ruleRemovedPackage, msg, pos, width))
+		}
+	}
+
+	for _, ident := range r.DeprecatedIdentifiers {
+		msg := ident.Message
+		if msg == "" {
+			msg = fmt.Sprintf("%s.%s has no equivalent in %s.", ident.ImportPath, ident.Identifier, migrator.SDKModPath)
+		}
+		if ident.Replacement != "" {
+			msg += fmt.Sprintf(" Suggested replacement: %s", ident.Replacement)
+		}
+		for _, pos := range ident.Positions {
+			results = append(results, newSARIFResult(ruleDeprecatedIdentifier, msg, pos, len(ident.Identifier)))
+		}
+	}
+
+	root := filepath.ToSlash(r.PluginPath)
+	if !strings.HasPrefix(root, "/") {
+		root = "/" + root
+	}
+	log := &sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []*sarifRun{{
+			Tool: sarifTool{sarifDriver{
+				Name:           "packer-sdk-migrator",
+				InformationURI: "https://github.com/hashicorp/packer-sdk-migrator",
+				Rules:          sarifRules,
+			}},
+			OriginalURIBaseIDs: map[string]*sarifArtifactURI{
+				sarifRootBaseID: {URI: "file://" + strings.TrimSuffix(root, "/") + "/"},
+			},
+			Results: results,
+		}},
+	}
+
+	return marshalReport(log)
+}
+
+func newSARIFResult(ruleID, msg string, pos *positionResult, width int) *sarifResult {
+	ruleIndex := 0
+	for i, rule := range sarifRules {
+		if rule.ID == ruleID {
+			ruleIndex = i
+		}
+	}
+
+	return &sarifResult{
+		RuleID:    ruleID,
+		RuleIndex: ruleIndex,
+		Level:     "error",
+		Message:   sarifMessage{msg},
+		Locations: []*sarifLocation{{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactURI{
+					URI:       pos.Filename,
+					URIBaseID: sarifRootBaseID,
+				},
+				Region: sarifRegion{
+					StartLine:   pos.Line,
+					StartColumn: pos.Column,
+					EndLine:     pos.Line,
+					EndColumn:   pos.Column + width,
+				},
+			},
+		}},
+	}
+}
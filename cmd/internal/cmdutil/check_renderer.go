@@ -0,0 +1,198 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-sdk-migrator/migrator"
+	"github.com/mitchellh/cli"
+)
+
+// CheckRenderer renders the events of a check to a cli.Ui as the text report
+// of the check command. The migrate command renders its check with it too.
+type CheckRenderer struct {
+	ui       cli.Ui
+	repoName string
+
+	// done is set once the plugin is found to be migrated already, or not
+	// to be a Packer plugin: the rest of the check is not reported.
+	done     bool
+	sdk      *migrator.VersionCheck
+	partial  bool
+	listed   bool
+	removed  []*migrator.CorePackage
+	offences []*migrator.Offence
+}
+
+func NewCheckRenderer(ui cli.Ui, repoName string) *CheckRenderer {
+	return &CheckRenderer{ui: ui, repoName: repoName}
+}
+
+// IsCheckPhase reports whether the phase is one of the phases of a check.
+func IsCheckPhase(phase string) bool {
+	switch phase {
+	case migrator.PhaseCheck, migrator.PhaseJournal, migrator.PhaseGoVersion, migrator.PhaseGoModules,
+		migrator.PhaseSDKVersion, migrator.PhaseFiles, migrator.PhasePackerVersion, migrator.PhaseCoreImports:
+		return true
+	}
+	return false
+}
+
+func (r *CheckRenderer) Observe(e *migrator.Event) {
+	if r.done {
+		return
+	}
+	switch e.Type {
+	case migrator.EventPhaseStarted:
+		r.phaseStarted(e.Phase)
+	case migrator.EventFinding:
+		r.finding(e.Finding)
+	case migrator.EventPhaseFinished:
+		if e.Err == nil {
+			r.phaseFinished(e.Phase, e.Result)
+		}
+	}
+}
+
+func (r *CheckRenderer) phaseStarted(phase string) {
+	switch phase {
+	case migrator.PhaseJournal:
+		r.ui.Output("Checking for a migration in progress...")
+	case migrator.PhaseGoVersion:
+		r.ui.Output("Checking Go runtime version ...")
+	case migrator.PhaseGoModules:
+		r.ui.Output("Checking whether plugin uses Go modules...")
+	case migrator.PhaseSDKVersion:
+		r.ui.Output(fmt.Sprintf("Checking version of %s to determine if plugin was already migrated...", migrator.SDKModPath))
+	case migrator.PhaseFiles:
+		if r.sdk != nil && r.sdk.Satisfied {
+			r.ui.Output(fmt.Sprintf("Checking whether any file still imports %s packages...", migrator.PackerModPath))
+		}
+	case migrator.PhasePackerVersion:
+		r.ui.Output(fmt.Sprintf("Checking version of %s used in plugin...", migrator.PackerModPath))
+	case migrator.PhaseCoreImports:
+		r.ui.Output("Checking whether plugin uses deprecated SDK packages or identifiers...")
+	}
+}
+
+func (r *CheckRenderer) finding(f *migrator.Finding) {
+	switch f.Kind {
+	case migrator.FindingMigrationInProgress:
+		// The rest of the check describes a half-migrated plugin.
+		r.done = true
+	case migrator.FindingGoVersion:
+		v := f.Value.(*migrator.VersionCheck)
+		if v.Satisfied {
+			r.ui.Info(fmt.Sprintf("Go version %s: OK.", v.Version))
+		} else {
+			r.ui.Warn(fmt.Sprintf("Go version does not satisfy constraint %s. Found Go version: %s.", v.Constraint, v.Version))
+		}
+	case migrator.FindingGoModules:
+		if f.Value.(bool) {
+			r.ui.Info("Go modules in use: OK.")
+		} else {
+			r.ui.Warn("Go modules not in use. plugin must use Go modules.")
+		}
+	case migrator.FindingSDKVersion:
+		r.sdk = f.Value.(*migrator.VersionCheck)
+		r.done = r.sdk.Version != "" && !r.sdk.Satisfied
+	case migrator.FindingPartiallyMigrated:
+		r.partial = true
+		r.ui.Warn("plugin is partially migrated. Files still importing Packer core packages:")
+		for _, file := range f.Value.([]*migrator.FileMigration) {
+			r.ui.Warn(fmt.Sprintf(" * %s: %s (%s)", file.Path, file.Status, strings.Join(file.CorePackages, ", ")))
+		}
+	case migrator.FindingPackerVersion:
+		v := f.Value.(*migrator.VersionCheck)
+		if v.Satisfied {
+			r.ui.Info(fmt.Sprintf("Packer version %s: OK.", v.Version))
+		} else if v.Version != "" {
+			r.ui.Warn(fmt.Sprintf("Packer version does not satisfy constraint %s. Found Packer version: %s", v.Constraint, v.Version))
+		} else if !r.partial {
+			r.done = true
+		}
+	case migrator.FindingCorePackage:
+		pkg := f.Value.(*migrator.CorePackage)
+		if !r.listed {
+			r.ui.Output("Packer core packages in use:")
+			r.listed = true
+		}
+		formatCorePackage(r.ui, pkg)
+		if pkg.Status == migrator.PackageRemoved {
+			r.removed = append(r.removed, pkg)
+		}
+	case migrator.FindingDeprecatedIdentifier:
+		r.offences = append(r.offences, f.Value.(*migrator.Offence))
+	}
+}
+
+func (r *CheckRenderer) phaseFinished(phase string, result interface{}) {
+	switch phase {
+	case migrator.PhaseFiles:
+		// Nothing is left to migrate in a plugin depending on the SDK.
+		r.done = r.sdk != nil && r.sdk.Satisfied && !r.partial
+	case migrator.PhaseCoreImports:
+		if len(r.removed) == 0 && len(r.offences) == 0 {
+			r.ui.Info("No imports of deprecated SDK packages or identifiers: OK.")
+		}
+		formatRemovedPackages(r.ui, r.removed)
+		formatRemovedIdents(r.ui, r.offences)
+	case migrator.PhaseCheck:
+		result := result.(*migrator.CheckResult)
+		var prettypluginName string
+		if r.repoName != "" {
+			prettypluginName = " " + r.repoName
+		}
+		if result.PartiallyMigrated && result.Migratable() {
+			r.ui.Info(fmt.Sprintf("\nplugin%s is partially migrated. Run migrate to finish migrating it to the new SDK.\n", prettypluginName))
+		} else if result.AllConstraintsSatisfied() {
+			r.ui.Info(fmt.Sprintf("\nAll constraints satisfied. plugin%s can be migrated to the new SDK.\n", prettypluginName))
+		} else if result.Migratable() {
+			r.ui.Info(fmt.Sprintf("\nplugin%s can be migrated to the new SDK, but Go version %s is recommended.\n", prettypluginName, result.GoVersion.Constraint))
+		}
+	}
+}
+
+func formatCorePackage(ui cli.Ui, pkg *migrator.CorePackage) {
+	switch pkg.Status {
+	case migrator.PackageMapped, migrator.PackageSplit:
+		ui.Output(fmt.Sprintf(" * %s: %s -> %s", pkg.ImportPath, pkg.Status, strings.Join(pkg.Targets, ", ")))
+	default:
+		ui.Output(fmt.Sprintf(" * %s: %s", pkg.ImportPath, pkg.Status))
+	}
+}
+
+func formatRemovedPackages(ui cli.Ui, removedPackagesInUse []*migrator.CorePackage) {
+	if len(removedPackagesInUse) == 0 {
+		return
+	}
+
+	ui.Warn("Deprecated SDK packages in use:")
+	for _, pkg := range removedPackagesInUse {
+		ui.Warn(fmt.Sprintf(" * %s", pkg.ImportPath))
+		for _, f := range pkg.Files {
+			ui.Warn(fmt.Sprintf("   * %s", f))
+		}
+	}
+}
+
+func formatRemovedIdents(ui cli.Ui, removedIdentsInUse []*migrator.Offence) {
+	if len(removedIdentsInUse) == 0 {
+		return
+	}
+	ui.Warn("Deprecated SDK identifiers in use:")
+	for _, ident := range removedIdentsInUse {
+		d := ident.IdentDeprecation
+		ui.Warn(fmt.Sprintf(" * %s (%s): %s", d.Identifier.Name, d.ImportPath, d.Message))
+		if d.Replacement != "" {
+			ui.Warn(fmt.Sprintf("   Suggested replacement: %s", d.Replacement))
+		}
+
+		for _, pos := range ident.Positions {
+			ui.Warn(fmt.Sprintf("   * %s", pos))
+		}
+	}
+}
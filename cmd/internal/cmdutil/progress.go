@@ -0,0 +1,37 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package cmdutil
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/packer-sdk-migrator/migrator"
+)
+
+// Progress modes, selecting how the check and migrate commands report their
+// progress.
+const (
+	ProgressText  = "text"
+	ProgressJSON  = "json"
+	ProgressQuiet = "quiet"
+)
+
+var ProgressModes = []string{ProgressText, ProgressJSON, ProgressQuiet}
+
+// NewObserver returns the observer rendering the progress of a command in the
+// given mode: text is the observer rendering it as text, json writes every
+// event to stdout as a line of JSON, and quiet reports nothing.
+func NewObserver(mode string, text migrator.Observer, pluginPath string) (migrator.Observer, error) {
+	switch mode {
+	case ProgressText:
+		return text, nil
+	case ProgressJSON:
+		return migrator.NewJSONLinesObserver(os.Stdout, pluginPath), nil
+	case ProgressQuiet:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unknown progress mode %q, expected one of: %s", mode, strings.Join(ProgressModes, ", "))
+}
@@ -4,30 +4,27 @@
 package migrate
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"go/printer"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/hashicorp/packer-sdk-migrator/cmd/check"
+	"github.com/hashicorp/packer-sdk-migrator/cmd/internal/cmdutil"
+	"github.com/hashicorp/packer-sdk-migrator/migrator"
 	"github.com/hashicorp/packer-sdk-migrator/util"
 	"github.com/mitchellh/cli"
 )
 
 const (
 	CommandName    = "migrate"
-	oldPackagePath = "github.com/hashicorp/packer"
 	newPackagePath = "github.com/hashicorp/packer-plugin-sdk"
-	defaultVersion = "v0.0.14"
+	defaultVersion = util.DefaultSDKVersion
 )
 
-var printConfig = printer.Config{
-	Mode:     printer.TabIndent | printer.UseSpaces,
-	Tabwidth: 8,
-}
-
 type command struct {
 	ui cli.Ui
 }
@@ -39,7 +36,7 @@ func CommandFactory(ui cli.Ui) func() (cli.Command, error) {
 }
 
 func (c *command) Help() string {
-	return `Usage: packer-sdk-migrator migrate [--help] [--sdk-version SDK_VERSION] [--force] [PATH]
+	return `Usage: packer-sdk-migrator migrate [--help] [--sdk-version SDK_VERSION] [--rules RULES_FILE] [--force] [--annotate] [--alias-policy POLICY] [--imports-local PREFIX] [--verify] [--progress MODE] [--timeout DURATION] [--resume] [--dry-run [--patch-out PATCH_FILE]] [PATH]
 
   Migrates the Packer plugin at PATH to the new Packer plugin
   SDK, defaulting to the git reference ` + defaultVersion + `.
@@ -48,13 +45,78 @@ func (c *command) Help() string {
   it is assumed that the current working directory contains a Packer plugin.
 
   Optionally, an SDK_VERSION can be passed, which is parsed as a Go module
-  release version. For example: v0.1.1, latest, master.
+  release version, such as v0.0.14, or a branch name, such as master. The
+  package mapping rules depend on the SDK version; the newest known rules are
+  used for branch names. Migration is refused for release versions without
+  known mapping rules unless --force is passed, in which case the newest known
+  rules are used. A partially migrated plugin, which depends on the SDK but
+  still imports Packer core packages, is migrated to the SDK version its
+  go.mod requires already, with the mapping rules of that version; any
+  SDK_VERSION passed must match it.
+
+  Optionally, a RULES_FILE written in HCL can be passed to extend or override
+  the built-in mapping of Packer core packages to SDK packages.
+
+  Rewrites import paths and go.mod. Before any file is overwritten, go.mod,
+  go.sum and every rewritten file are backed up to
+  PATH/` + util.StateDir + `/backups. Use the restore command to roll back.
+
+  Backups and the journal are kept in PATH/` + util.StateDir + `. The
+  directory holds a .gitignore, so git ignores it. Delete it once the
+  backups are no longer needed.
+
+  The migration is applied as a single transaction: each file is replaced
+  atomically, and if any step fails, including ` + "`go mod tidy`" + `, every
+  change already made is rolled back.
+
+  With --annotate, a ` + "`// " + util.AnnotationPrefix + "...`" + ` comment
+  explaining the manual work left is inserted above each statement the
+  migrator cannot migrate automatically, such as uses of identifiers or
+  packages without an SDK equivalent.
+
+  With --alias-policy, the names rewritten packages are imported as can be
+  chosen: "default" keeps existing names, "table" uses the aliases configured
+  by alias rules, such as packersdk for the SDK packer package, and "camel"
+  derives camelCase names for the destinations of split packages instead of
+  names like packercommon_commonsteps. Configured aliases must not conflict
+  with identifiers already declared in the file. Any other name that would
+  conflict with an import, a package-level identifier, or a local identifier
+  in scope of its uses is replaced by an alias such as sdkcommonsteps, and
+  reported.
 
-  Rewrites import paths and go.mod. No backup is made before files are
-  overwritten.
+  With --imports-local, the imports of every file the migrator rewrites are
+  regrouped into standard library, third-party and local imports, and the
+  file is formatted with gofmt, as goimports -local PREFIX would. PREFIX is a
+  comma-separated list of import path prefixes of local packages. Files the
+  migrator does not change are left alone.
+
+  With --verify, the plugin is built, vetted and its tests are compiled, but
+  not run, once ` + "`go mod tidy`" + ` succeeded. Each compiler error is listed
+  with the mapping rule which rewrote its line, if any, and the command exits
+  with status 1 if any of them fail. The migration is kept either way.
+
+  MODE selects how progress is reported: text (default), json or quiet.
+  json prints each phase started or finished, each file written and each
+  finding as a line of JSON. quiet only prints errors and warnings, and the
+  diff of a dry run.
+
+  With --timeout, the migration stops once DURATION, e.g. 10m, has elapsed,
+  killing any command still running, such as ` + "`go mod tidy`" + `. The
+  migration also stops when interrupted with Ctrl-C. Files are never left
+  half-written: unless ` + "`go mod tidy`" + ` already succeeded, every change
+  is rolled back.
+
+  The progress of the migration is recorded in a journal in
+  PATH/` + util.StateDir + `/journal until ` + "`go mod tidy`" + ` succeeded. If
+  the migrator dies before that, run it again with --resume to finish the
+  migration, or run the restore command to roll it back.
+
+  With --dry-run, no files are written and ` + "`go mod tidy`" + ` is not run.
+  Instead, the changes that would be made are printed as a unified diff, or
+  written to PATCH_FILE if --patch-out is passed.
 
 Example:
-  packer-sdk-migrator migrate --sdk-version master github.com/my-packer-plugin/packer-builder-local`
+  packer-sdk-migrator migrate --sdk-version v0.0.14 github.com/my-packer-plugin/packer-builder-local`
 }
 
 func (c *command) Synopsis() string {
@@ -67,8 +129,72 @@ func (c *command) Run(args []string) int {
 	flags.StringVar(&sdkVersion, "sdk-version", defaultVersion, "SDK version")
 	var forceMigration bool
 	flags.BoolVar(&forceMigration, "force", false, "Whether to ignore failing checks and force migration")
+	var rulesPath string
+	flags.StringVar(&rulesPath, "rules", "", "HCL file extending the built-in mapping rules")
+	var annotate bool
+	flags.BoolVar(&annotate, "annotate", false, "Insert TODO comments above code that has to be migrated by hand")
+	var aliasPolicyName string
+	flags.StringVar(&aliasPolicyName, "alias-policy", util.AliasDefault.String(),
+		"Naming of rewritten imports: "+strings.Join(util.AliasPolicies, ", "))
+	var localPrefix string
+	flags.StringVar(&localPrefix, "imports-local", "", "Group imports starting with this comma-separated list of prefixes after third-party ones, and gofmt rewritten files")
+	var verify bool
+	flags.BoolVar(&verify, "verify", false, "Build, vet and compile the tests of the plugin after migrating it")
+	var dryRun bool
+	flags.BoolVar(&dryRun, "dry-run", false, "Print the changes as a unified diff instead of writing them")
+	var patchOut string
+	flags.StringVar(&patchOut, "patch-out", "", "File to write the dry-run diff to")
+	var timeout time.Duration
+	flags.DurationVar(&timeout, "timeout", 0, "Stop the migration after this duration, e.g. 10m")
+	var resume bool
+	flags.BoolVar(&resume, "resume", false, "Resume the migration in progress recorded in the journal of the plugin")
+	var progress string
+	flags.StringVar(&progress, "progress", cmdutil.ProgressText, "Progress reporting: "+strings.Join(cmdutil.ProgressModes, ", "))
 	flags.Parse(args)
 
+	if patchOut != "" && !dryRun {
+		c.ui.Error("--patch-out can only be used together with --dry-run")
+		return 1
+	}
+	if resume && dryRun {
+		c.ui.Error("--resume cannot be used together with --dry-run")
+		return 1
+	}
+	if progress == cmdutil.ProgressJSON && dryRun && patchOut == "" {
+		c.ui.Error("--progress json requires --patch-out with --dry-run")
+		return 1
+	}
+	verbose := progress == cmdutil.ProgressText
+
+	aliasPolicy, err := util.ParseAliasPolicy(aliasPolicyName)
+	if err != nil {
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	ruleSet, err := util.LoadRules(rulesPath)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error loading rules file: %s", err))
+		return 1
+	}
+	if _, fallback, err := ruleSet.ForReference(sdkVersion); fallback {
+		c.ui.Warn(fmt.Sprintf("SDK version %s is not a release version; using the newest known mapping rules", sdkVersion))
+	} else if err != nil {
+		if !forceMigration {
+			c.ui.Error(err.Error())
+			return 1
+		}
+		c.ui.Warn(fmt.Sprintf("%s; using the newest known mapping rules", err))
+	}
+	// A partially migrated plugin keeps the SDK version it requires, unless
+	// another one is requested explicitly.
+	requestedVersion := ""
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "sdk-version" {
+			requestedVersion = sdkVersion
+		}
+	})
+
 	var pluginRepoName string
 	var pluginPath string
 	if flags.NArg() == 1 {
@@ -90,87 +216,361 @@ func (c *command) Run(args []string) int {
 		return cli.RunResultHelp
 	}
 
-	err := check.RunCheck(c.ui, pluginPath, pluginRepoName)
+	renderer := &textRenderer{
+		ui:         c.ui,
+		check:      cmdutil.NewCheckRenderer(c.ui, pluginRepoName),
+		pluginPath: pluginPath,
+		repoName:   pluginRepoName,
+		sdkVersion: sdkVersion,
+		timeout:    timeout,
+	}
+	observer, err := cmdutil.NewObserver(progress, renderer, pluginPath)
 	if err != nil {
-		c.ui.Warn(err.Error())
-		if forceMigration {
-			c.ui.Warn("Ignoring failed eligibility checks")
-		} else {
-			c.ui.Error("plugin failed eligibility check for migration to the new SDK. Please see messages above.")
+		c.ui.Error(err.Error())
+		return 1
+	}
+
+	ctx, cancel := cmdutil.NewContext(timeout)
+	defer cancel()
+	result, err := migrator.Migrate(ctx, migrator.Options{
+		PluginPath: pluginPath,
+		SDKVersion: requestedVersion,
+		RuleSet:    ruleSet,
+		Force:      forceMigration,
+		DryRun:     dryRun,
+		Verify:     verify,
+		Resume:     resume,
+		Imports: util.ImportsOptions{
+			Annotate:    annotate,
+			AliasPolicy: aliasPolicy,
+			LocalPrefix: localPrefix,
+		},
+		Observer: observer,
+	})
+	if result == nil {
+		c.ui.Error(cmdutil.DescribeErr(err, timeout))
+		return 1
+	}
+	var eligibilityErr *migrator.EligibilityError
+	if errors.As(err, &eligibilityErr) {
+		c.ui.Warn(eligibilityErr.Err.Error())
+		c.ui.Error("plugin failed eligibility check for migration to the new SDK. Please see messages above.")
+		return 1
+	}
+
+	status := 0
+	var phaseErr *migrator.PhaseError
+	if errors.As(err, &phaseErr) {
+		if !verbose {
+			// The text renderer has reported the error already.
+			c.ui.Error(fmt.Sprintf("Error %s: %s", phaseErr.Phase, cmdutil.DescribeErr(phaseErr.Err, timeout)))
+		}
+		if phaseErr.Phase != migrator.PhaseVerify {
 			return 1
 		}
+		status = 1
+	} else if err != nil {
+		c.ui.Error(cmdutil.DescribeErr(err, timeout))
+		return 1
 	}
 
-	c.ui.Output("Rewriting plugin go.mod file...")
-	err = util.RewriteGoMod(pluginPath, sdkVersion, oldPackagePath, newPackagePath)
-	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error rewriting go.mod file: %s", err))
-		return 1
+	if dryRun {
+		if status == 0 {
+			status = c.outputDiff(pluginPath, result.Changes(), patchOut, verbose)
+		}
+		if status == 0 && annotate && verbose {
+			renderer.reportAnnotations(result)
+		}
+		return status
 	}
 
-	c.ui.Output("Rewriting SDK package imports...")
-	err = filepath.Walk(pluginPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if annotate && verbose {
+		renderer.reportAnnotations(result)
+	}
+	if verify && !result.Verified() {
+		status = 1
+	}
+	if verbose {
+		c.ui.Info(fmt.Sprintf("Make sure to review all changes and run all tests. "+
+			"To undo the migration, run `packer-sdk-migrator restore --backup %s`.", result.Backup.ID))
+	}
+	return status
+}
+
+// textRenderer renders the events of a migration to a cli.Ui.
+type textRenderer struct {
+	ui    cli.Ui
+	check *cmdutil.CheckRenderer
+
+	pluginPath string
+	repoName   string
+	sdkVersion string
+	timeout    time.Duration
+
+	skipped       []*util.SkippedReference
+	aliases       []*util.AliasDecision
+	mappingErrors []*util.MappingError
+	// verifyPassed is unset once a verification command failed, and
+	// compileErrors and rewrittenErrors count the errors reported.
+	verifyPassed    bool
+	compileErrors   int
+	rewrittenErrors int
+}
+
+func (r *textRenderer) Observe(e *migrator.Event) {
+	if e.Type == migrator.EventFinding && e.Finding.Kind == migrator.FindingIgnoredCheck {
+		r.ui.Warn(e.Finding.Value.(error).Error())
+		r.ui.Warn("Ignoring failed eligibility checks")
+		return
+	}
+	if e.Type == migrator.EventFinding && e.Finding.Kind == migrator.FindingResumed {
+		journal := e.Finding.Value.(*util.Journal)
+		r.ui.Output(fmt.Sprintf("Resuming the migration started at %s: %d of %d files were written.",
+			journal.StartedAt.Local().Format("2006-01-02 15:04:05"), journal.Written(), len(journal.Files)))
+		r.sdkVersion = journal.SDKVersion
+		return
+	}
+	if cmdutil.IsCheckPhase(e.Phase) {
+		r.check.Observe(e)
+		return
+	}
+
+	switch e.Type {
+	case migrator.EventPhaseStarted:
+		r.phaseStarted(e.Phase)
+	case migrator.EventFinding:
+		r.finding(e.Finding)
+	case migrator.EventPhaseFinished:
+		var phaseErr *migrator.PhaseError
+		if errors.As(e.Err, &phaseErr) {
+			r.phaseFailed(phaseErr)
+		} else if e.Err == nil {
+			r.phaseFinished(e.Phase, e.Result)
+		}
+	}
+}
+
+func (r *textRenderer) phaseStarted(phase string) {
+	switch phase {
+	case migrator.PhaseGoMod:
+		r.ui.Output("Rewriting plugin go.mod file...")
+	case migrator.PhaseImports:
+		r.ui.Output("Rewriting SDK package imports...")
+	case migrator.PhaseBackup:
+		r.ui.Output("Backing up files to be modified...")
+	case migrator.PhaseWrite:
+		r.ui.Output("Writing changes...")
+	case migrator.PhaseTidy:
+		r.ui.Output("Running `go mod tidy`...")
+	case migrator.PhaseVerify:
+		r.ui.Output("Verifying the migrated plugin...")
+		r.verifyPassed = true
+	}
+}
+
+func (r *textRenderer) finding(f *migrator.Finding) {
+	switch f.Kind {
+	case migrator.FindingSkippedReference:
+		r.skipped = append(r.skipped, f.Value.(*util.SkippedReference))
+	case migrator.FindingAlias:
+		r.aliases = append(r.aliases, f.Value.(*util.AliasDecision))
+	case migrator.FindingMappingError:
+		r.mappingErrors = append(r.mappingErrors, f.Value.(*util.MappingError))
+	case migrator.FindingStaleTempFile:
+		r.ui.Warn(fmt.Sprintf("Removed temporary file left by the interrupted migration: %s", f.Value.(string)))
+	case migrator.FindingVendored:
+		r.ui.Info("\nIt looks like this plugin vendors dependencies. " +
+			"Don't forget to run `go mod vendor`.")
+	case migrator.FindingVerifyStep:
+		r.reportVerifyStep(f.Value.(*util.VerifyStep))
+	}
+}
+
+func (r *textRenderer) phaseFinished(phase string, result interface{}) {
+	switch phase {
+	case migrator.PhaseGoMod:
+		r.sdkVersion = result.(string)
+	case migrator.PhaseImports:
+		r.warnSkipped()
+		r.reportAliases()
+	case migrator.PhaseBackup:
+		backup := result.(*util.BackupManifest)
+		r.ui.Info(fmt.Sprintf("Backed up %d files to %s.", len(backup.Files),
+			util.BackupDir(r.pluginPath, backup.ID)))
+	case migrator.PhaseTidy:
+		var prettypluginName string
+		if r.repoName != "" {
+			prettypluginName = " " + r.repoName
+		}
+		r.ui.Info(fmt.Sprintf("Success! plugin%s is migrated to %s %s.",
+			prettypluginName, newPackagePath, r.sdkVersion))
+	case migrator.PhaseVerify:
+		if r.compileErrors > 0 {
+			r.ui.Warn(fmt.Sprintf("%d of %d errors are on lines rewritten by the migrator.", r.rewrittenErrors, r.compileErrors))
+		}
+		if r.verifyPassed {
+			r.ui.Info("The migrated plugin builds, passes go vet and its tests compile.")
 		}
-		if info.IsDir() && info.Name() == "vendor" {
-			return filepath.SkipDir
+	}
+}
+
+// phaseFailed explains why the migration failed, and whether it was rolled
+// back.
+func (r *textRenderer) phaseFailed(pe *migrator.PhaseError) {
+	r.ui.Error(fmt.Sprintf("Error %s: %s", pe.Phase, cmdutil.DescribeErr(pe.Err, r.timeout)))
+	if pe.Phase == migrator.PhaseTidy {
+		r.reportMappingErrors()
+	}
+	if pe.RolledBack {
+		r.reportRollback(pe)
+	}
+}
+
+// reportMappingErrors explains the go mod tidy failures caused by mapping
+// rules.
+func (r *textRenderer) reportMappingErrors() {
+	errs := r.mappingErrors
+	if len(errs) == 0 {
+		return
+	}
+	r.ui.Error(fmt.Sprintf("%d packages introduced by mapping rules could not be resolved:", len(errs)))
+	for _, me := range errs {
+		r.ui.Error(fmt.Sprintf(" * %s", me.Package))
+		r.ui.Error(fmt.Sprintf("   %s", me.Message))
+		rule := fmt.Sprintf("the %s rule for %s", me.Kind, me.From)
+		if me.Source.Filename != "" {
+			rule += fmt.Sprintf(" at %s", me.Source)
 		}
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".go") {
-			err := util.RewriteImportedPackageImports(path)
-			if err != nil {
-				return err
+		r.ui.Error(fmt.Sprintf("   It was introduced by %s.", rule))
+		for _, pos := range me.Importers {
+			if rel, err := filepath.Rel(r.pluginPath, pos.Filename); err == nil {
+				pos.Filename = rel
+			}
+			r.ui.Error(fmt.Sprintf("   Imported at %s", pos))
+		}
+		if suggested := me.SuggestedRule(); suggested != "" {
+			r.ui.Warn(fmt.Sprintf("   Did you mean %s? Fix the mapping with a rules file passed with --rules:", me.Suggestion))
+			for _, line := range strings.Split(strings.TrimSpace(suggested), "\n") {
+				r.ui.Warn("     " + line)
 			}
 		}
-		return nil
-	})
-	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error rewriting SDK imports: %s", err))
-		return 1
 	}
+}
 
-	c.ui.Output("Running `go mod tidy`...")
-	err = util.GoModTidy(pluginPath)
-	if err != nil {
-		c.ui.Error(fmt.Sprintf("Error running go mod tidy: %s", err))
-		return 1
+// reportVerifyStep prints the result of a command run by --verify.
+func (r *textRenderer) reportVerifyStep(step *util.VerifyStep) {
+	if step.Passed() {
+		r.ui.Info(fmt.Sprintf("`%s`: OK.", step.Command))
+		return
+	}
+	r.verifyPassed = false
+	if len(step.Errors) == 0 {
+		// Either every error was already reported by an earlier step, or
+		// the output could not be parsed.
+		r.ui.Error(fmt.Sprintf("`%s` failed: %s", step.Command, step.Err))
+		return
+	}
+	r.ui.Error(fmt.Sprintf("`%s` failed:", step.Command))
+	for _, ce := range step.Errors {
+		r.compileErrors++
+		pos := ce.Position
+		if rel, err := filepath.Rel(r.pluginPath, pos.Filename); err == nil {
+			pos.Filename = rel
+		}
+		msg := fmt.Sprintf(" * %s: %s", pos, ce.Message)
+		if len(ce.Rewrites) > 0 {
+			r.rewrittenErrors++
+			rules := []string{}
+			for _, rw := range ce.Rewrites {
+				rules = append(rules, rw.String())
+			}
+			msg += fmt.Sprintf(" (line rewritten by mapping rule %s)", strings.Join(rules, ", "))
+		}
+		r.ui.Error(msg)
 	}
+}
 
-	var prettypluginName string
-	if pluginRepoName != "" {
-		prettypluginName = " " + pluginRepoName
+// reportAnnotations prints the number of TODO comments inserted by --annotate.
+func (r *textRenderer) reportAnnotations(result *migrator.MigrationResult) {
+	count, files := result.Annotations()
+	if count == 0 {
+		r.ui.Info("No TODO comments were inserted: nothing has to be migrated by hand.")
+		return
 	}
-	c.ui.Info(fmt.Sprintf("Success! plugin%s is migrated to %s %s.",
-		prettypluginName, newPackagePath, sdkVersion))
+	r.ui.Warn(fmt.Sprintf("Inserted %d TODO comments in %d files. Find them with `grep -rn %q .`.",
+		count, files, strings.TrimSpace(util.AnnotationPrefix)))
+}
 
-	hasVendor, err := HasVendorFolder(pluginPath)
-	if err != nil {
-		c.ui.Error(fmt.Sprintf("Failed to check vendor folder: %s", err))
-		return 1
+// warnSkipped lists the references the rewriter left untouched, which have to
+// be migrated by hand.
+func (r *textRenderer) warnSkipped() {
+	if len(r.skipped) == 0 {
+		return
 	}
 
-	if hasVendor {
-		c.ui.Info("\nIt looks like this plugin vendors dependencies. " +
-			"Don't forget to run `go mod vendor`.")
+	r.ui.Warn(fmt.Sprintf("%d references could not be rewritten safely and were left untouched:", len(r.skipped)))
+	for _, s := range r.skipped {
+		r.ui.Warn(fmt.Sprintf(" * %s", s))
 	}
+}
 
-	c.ui.Info(fmt.Sprintf("Make sure to review all changes and run all tests."))
-	return 0
+// reportAliases lists the imports given an alias because their default name
+// was already taken.
+func (r *textRenderer) reportAliases() {
+	if len(r.aliases) == 0 {
+		return
+	}
+
+	r.ui.Info(fmt.Sprintf("%d imports were given an alias to avoid conflicting names:", len(r.aliases)))
+	for _, a := range r.aliases {
+		r.ui.Info(fmt.Sprintf(" * %s", a))
+	}
+}
+
+// reportRollback reports whether the changes of a failed migration were rolled
+// back.
+func (r *textRenderer) reportRollback(pe *migrator.PhaseError) {
+	r.ui.Output("Rolling back all changes...")
+	if pe.RollbackErr != nil {
+		r.ui.Error(fmt.Sprintf("Error rolling back changes: %s", pe.RollbackErr))
+		r.ui.Warn(fmt.Sprintf("The plugin may be partially migrated. To restore it, run "+
+			"`packer-sdk-migrator restore --backup %s`.", pe.Backup.ID))
+		return
+	}
+	r.ui.Warn("All changes were rolled back; the plugin was left unmodified.")
 }
 
-func HasVendorFolder(pluginPath string) (bool, error) {
-	vendorPath := filepath.Join(pluginPath, "vendor")
-	fs, err := os.Stat(vendorPath)
+// outputDiff prints the changes of a dry run, or writes them to patchOut. The
+// outcome is only reported if verbose is set.
+func (c *command) outputDiff(pluginPath string, changes []*util.FileChange, patchOut string, verbose bool) int {
+	diff, err := util.UnifiedDiff(pluginPath, changes)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		} else {
-			return false, err
+		c.ui.Error(fmt.Sprintf("Error computing diff: %s", err))
+		return 1
+	}
+
+	if diff == "" {
+		if verbose {
+			c.ui.Info("Dry run: no changes would be made.")
 		}
+		return 0
 	}
-	if !fs.Mode().IsDir() {
-		return false, fmt.Errorf("%s is not folder (expected folder)", vendorPath)
+
+	if patchOut != "" {
+		err := ioutil.WriteFile(patchOut, []byte(diff), 0644)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error writing patch file: %s", err))
+			return 1
+		}
+		if verbose {
+			c.ui.Info(fmt.Sprintf("Dry run: changes written to %s. Apply them from the plugin directory with `patch -p1 < %s`.", patchOut, patchOut))
+		}
+	} else {
+		c.ui.Output(diff)
 	}
 
-	return true, nil
+	if verbose {
+		c.ui.Info("Dry run: no files were modified and `go mod tidy` was not run.")
+	}
+	return 0
 }
@@ -0,0 +1,125 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package restore
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/packer-sdk-migrator/util"
+	"github.com/mitchellh/cli"
+)
+
+const CommandName = "restore"
+
+type command struct {
+	ui cli.Ui
+}
+
+func CommandFactory(ui cli.Ui) func() (cli.Command, error) {
+	return func() (cli.Command, error) {
+		return &command{ui}, nil
+	}
+}
+
+func (c *command) Help() string {
+	return `Usage: packer-sdk-migrator restore [--help] [--list] [--backup BACKUP_ID] [PATH]
+
+  Restores the files of the Packer plugin at PATH from a backup taken by
+  the migrate command, defaulting to the most recent backup. Backups are
+  kept in PATH/` + util.StateDir + `/backups, which git ignores.
+
+  PATH is resolved relative to $GOPATH/src/PATH. If it is not supplied,
+  it is assumed that the current working directory contains a Packer plugin.
+
+  The checksums recorded when the backup was taken are verified before any
+  file is restored. Files created by the migration are removed, and so is
+  the journal of a migration in progress, which can no longer be resumed.
+
+  With --list, the available backups are listed and nothing is restored.
+
+Example:
+  packer-sdk-migrator restore --backup 20210115T101500Z github.com/my-packer-plugin/packer-builder-local`
+}
+
+func (c *command) Synopsis() string {
+	return "Restores a Packer plugin from a backup taken before migration."
+}
+
+func (c *command) Run(args []string) int {
+	flags := flag.NewFlagSet(CommandName, flag.ExitOnError)
+	var list bool
+	flags.BoolVar(&list, "list", false, "List available backups")
+	var backupID string
+	flags.StringVar(&backupID, "backup", "", "ID of the backup to restore")
+	flags.Parse(args)
+
+	var pluginPath string
+	if flags.NArg() == 1 {
+		var err error
+		pluginRepoName := flags.Args()[0]
+		pluginPath, err = util.GetpluginPath(pluginRepoName)
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error finding plugin %s: %s", pluginRepoName, err))
+			return 1
+		}
+	} else if flags.NArg() == 0 {
+		var err error
+		pluginPath, err = os.Getwd()
+		if err != nil {
+			c.ui.Error(fmt.Sprintf("Error finding current working directory: %s", err))
+			return 1
+		}
+	} else {
+		return cli.RunResultHelp
+	}
+
+	backups, err := util.ListBackups(pluginPath)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error reading backups: %s", err))
+		return 1
+	}
+	if len(backups) == 0 {
+		c.ui.Error(fmt.Sprintf("No backups found in %s.", pluginPath))
+		return 1
+	}
+
+	if list {
+		for _, b := range backups {
+			c.ui.Output(fmt.Sprintf("%s  %s  %d files", b.ID, b.CreatedAt.Local().Format("2006-01-02 15:04:05"), len(b.Files)))
+		}
+		return 0
+	}
+
+	backup := backups[len(backups)-1]
+	if backupID != "" {
+		backup = nil
+		for _, b := range backups {
+			if b.ID == backupID {
+				backup = b
+			}
+		}
+		if backup == nil {
+			c.ui.Error(fmt.Sprintf("Backup %s not found. Use --list to show available backups.", backupID))
+			return 1
+		}
+	}
+
+	c.ui.Output(fmt.Sprintf("Restoring %d files from backup %s...", len(backup.Files), backup.ID))
+	err = util.RestoreBackup(pluginPath, backup)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error restoring backup: %s", err))
+		return 1
+	}
+	// A migration in progress cannot be resumed once the plugin is restored.
+	err = util.RemoveJournal(pluginPath)
+	if err != nil {
+		c.ui.Error(fmt.Sprintf("Error removing migration journal: %s", err))
+		return 1
+	}
+
+	c.ui.Info(fmt.Sprintf("Success! Restored plugin from backup %s.", backup.ID))
+	return 0
+}
@@ -1,6 +1,6 @@
 module github.com/hashicorp/packer-sdk-migrator
 
-go 1.12
+go 1.16
 
 require (
 	github.com/google/go-cmp v0.5.4
@@ -10,6 +10,7 @@ require (
 	github.com/hashicorp/packer v1.6.6
 	github.com/kmoe/go-list v1.0.0
 	github.com/mitchellh/cli v1.1.0
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/radeksimko/go-refs v0.0.0-20190823125319-880a3294a1a0
 	golang.org/x/mod v0.3.0
 	golang.org/x/tools v0.0.0-20201111133315-69daaf961d65
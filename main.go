@@ -10,6 +10,7 @@ import (
 	"github.com/hashicorp/logutils"
 	"github.com/hashicorp/packer-sdk-migrator/cmd/check"
 	"github.com/hashicorp/packer-sdk-migrator/cmd/migrate"
+	"github.com/hashicorp/packer-sdk-migrator/cmd/restore"
 	"github.com/mitchellh/cli"
 )
 
@@ -38,6 +39,7 @@ func main() {
 	c.Commands = map[string]cli.CommandFactory{
 		check.CommandName:   check.CommandFactory(ui),
 		migrate.CommandName: migrate.CommandFactory(ui),
+		restore.CommandName: restore.CommandFactory(ui),
 	}
 
 	exitStatus, err := c.Run()
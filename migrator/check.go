@@ -0,0 +1,262 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/packer-sdk-migrator/util"
+)
+
+// VersionCheck is the version of a dependency found for the plugin, and
+// whether it satisfies the constraint of the check.
+type VersionCheck struct {
+	// Version is empty if the dependency was not found.
+	Version    string `json:"version"`
+	Constraint string `json:"constraint"`
+	Satisfied  bool   `json:"satisfied"`
+}
+
+// CheckResult is the outcome of checking whether a plugin can be migrated.
+type CheckResult struct {
+	PluginPath string
+	// Journal is the journal of a migration in progress, if any.
+	Journal       *util.Journal
+	GoVersion     VersionCheck
+	GoModulesUsed bool
+	SDKVersion    VersionCheck
+	// Files lists the migration status of the Go files importing Packer core
+	// or SDK packages, sorted by path.
+	Files []*FileMigration
+	// AlreadyMigrated is set if the plugin depends on a version of the SDK
+	// satisfying SDKVersionConstraint, and no file imports Packer core
+	// packages anymore.
+	AlreadyMigrated bool
+	// PartiallyMigrated is set if the plugin depends on a version of the SDK
+	// satisfying SDKVersionConstraint, but some files still import Packer
+	// core packages. Migrating it rewrites these files.
+	PartiallyMigrated bool
+	PackerVersion     VersionCheck
+	// CorePackages lists the Packer core packages imported by the plugin,
+	// sorted by import path.
+	CorePackages []*CorePackage
+	// DeprecatedIdentifiers lists the references to identifiers without SDK
+	// equivalent.
+	DeprecatedIdentifiers []*Offence
+}
+
+// Stragglers returns the files which still import Packer core packages.
+func (r *CheckResult) Stragglers() []*FileMigration {
+	return Stragglers(r.Files)
+}
+
+// RemovedPackages returns the imported Packer core packages with no SDK
+// equivalent.
+func (r *CheckResult) RemovedPackages() []*CorePackage {
+	return removedPackages(r.CorePackages)
+}
+
+// UsesRemovedPackagesOrIdents reports whether the plugin uses packages or
+// identifiers with no SDK equivalent.
+func (r *CheckResult) UsesRemovedPackagesOrIdents() bool {
+	return len(r.RemovedPackages()) > 0 || len(r.DeprecatedIdentifiers) > 0
+}
+
+// AllConstraintsSatisfied reports whether the plugin satisfies every
+// constraint.
+func (r *CheckResult) AllConstraintsSatisfied() bool {
+	return r.GoVersion.Satisfied && r.Migratable()
+}
+
+// Migratable reports whether the plugin can be migrated, possibly with a
+// more recent Go version. The Packer version is not checked for a partially
+// migrated plugin, which may not depend on Packer core anymore.
+func (r *CheckResult) Migratable() bool {
+	return r.GoModulesUsed && (r.PackerVersion.Satisfied || r.PartiallyMigrated) && !r.UsesRemovedPackagesOrIdents()
+}
+
+// Err returns the reason the plugin cannot be migrated, or nil if it can:
+// a *MigrationInProgress error if a migration died halfway, an
+// *AlreadyMigrated error if it depends on the SDK already and no file
+// imports Packer core packages anymore, and
+// ErrConstraintsNotSatisfied if it fails any constraint.
+func (r *CheckResult) Err() error {
+	if r.Journal != nil {
+		return &MigrationInProgress{r.Journal}
+	}
+	if r.AlreadyMigrated {
+		return &AlreadyMigrated{r.SDKVersion.Version}
+	}
+	if r.SDKVersion.Version != "" && !r.SDKVersion.Satisfied {
+		return fmt.Errorf("plugin already migrated, but SDK version %s does not satisfy constraint %s.",
+			r.SDKVersion.Version, r.SDKVersion.Constraint)
+	}
+	if r.PackerVersion.Version == "" && !r.PartiallyMigrated {
+		return fmt.Errorf("This directory (%s) doesn't seem to be a Packer plugin.\nplugins depend on %s", r.PluginPath, PackerModPath)
+	}
+	if !r.Migratable() {
+		return ErrConstraintsNotSatisfied
+	}
+	return nil
+}
+
+// Phases of a check, as reported to the Observer. PhaseCheck spans all the
+// others.
+const (
+	PhaseCheck         = "checking eligibility"
+	PhaseJournal       = "checking for a migration in progress"
+	PhaseGoVersion     = "checking Go runtime version"
+	PhaseGoModules     = "checking Go modules"
+	PhaseSDKVersion    = "checking SDK version"
+	PhaseFiles         = "checking migration status of files"
+	PhasePackerVersion = "checking Packer version"
+	PhaseCoreImports   = "checking Packer core imports and identifiers"
+)
+
+// Check evaluates every constraint a plugin must satisfy to be migrated. An
+// error is only returned if the check could not be completed; whether the
+// plugin can be migrated is told by the result.
+func Check(ctx context.Context, opts Options) (*CheckResult, error) {
+	rules, err := opts.rules()
+	if err != nil {
+		return nil, err
+	}
+	opts.started(PhaseCheck)
+	result, err := check(ctx, &opts, rules)
+	if err != nil {
+		return nil, opts.failed(PhaseCheck, err)
+	}
+	opts.finished(PhaseCheck, result)
+	return result, nil
+}
+
+func check(ctx context.Context, opts *Options, rules *util.Rules) (*CheckResult, error) {
+	pluginPath := opts.PluginPath
+	result := &CheckResult{PluginPath: pluginPath}
+
+	opts.started(PhaseJournal)
+	journal, err := util.ReadJournal(pluginPath)
+	if err != nil {
+		return nil, opts.failed(PhaseJournal, err)
+	}
+	result.Journal = journal
+	if journal != nil {
+		opts.found(PhaseJournal, FindingMigrationInProgress, journal)
+	}
+	opts.finished(PhaseJournal, nil)
+
+	opts.started(PhaseGoVersion)
+	goVersion, goVersionSatisfied := CheckGoVersion(pluginPath)
+	result.GoVersion = VersionCheck{goVersion, GoVersionConstraint, goVersionSatisfied}
+	opts.found(PhaseGoVersion, FindingGoVersion, &result.GoVersion)
+	opts.finished(PhaseGoVersion, nil)
+
+	opts.started(PhaseGoModules)
+	result.GoModulesUsed = CheckForGoModules(pluginPath)
+	opts.found(PhaseGoModules, FindingGoModules, result.GoModulesUsed)
+	opts.finished(PhaseGoModules, nil)
+
+	opts.started(PhaseSDKVersion)
+	sdkVersion, sdkVersionSatisfied, err := CheckDependencyVersion(pluginPath, SDKModPath, SDKVersionConstraint)
+	if err != nil {
+		return nil, opts.failed(PhaseSDKVersion, fmt.Errorf("Error getting SDK version for plugin %s: %s", pluginPath, err))
+	}
+	result.SDKVersion = VersionCheck{sdkVersion, SDKVersionConstraint, sdkVersionSatisfied}
+	opts.found(PhaseSDKVersion, FindingSDKVersion, &result.SDKVersion)
+	opts.finished(PhaseSDKVersion, nil)
+
+	opts.started(PhaseFiles)
+	files, err := CheckFileMigrations(ctx, pluginPath)
+	if err != nil {
+		return nil, opts.failed(PhaseFiles, err)
+	}
+	result.Files = files
+	for _, f := range files {
+		opts.found(PhaseFiles, FindingFile, f)
+	}
+	stragglers := len(Stragglers(files)) > 0
+	result.AlreadyMigrated = sdkVersionSatisfied && !stragglers
+	result.PartiallyMigrated = sdkVersionSatisfied && stragglers
+	if result.PartiallyMigrated {
+		opts.found(PhaseFiles, FindingPartiallyMigrated, Stragglers(files))
+	}
+	opts.finished(PhaseFiles, nil)
+
+	opts.started(PhasePackerVersion)
+	packerVersion, packerVersionSatisfied, err := CheckDependencyVersion(pluginPath, PackerModPath, PackerVersionConstraint)
+	if err != nil {
+		return nil, opts.failed(PhasePackerVersion, fmt.Errorf("Error getting Packer version for plugin %s: %s", pluginPath, err))
+	}
+	result.PackerVersion = VersionCheck{packerVersion, PackerVersionConstraint, packerVersionSatisfied}
+	opts.found(PhasePackerVersion, FindingPackerVersion, &result.PackerVersion)
+	opts.finished(PhasePackerVersion, nil)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	opts.started(PhaseCoreImports)
+	corePackages, removedIdentsInUse, err := CheckSDKPackageImportsAndRefs(ctx, pluginPath, rules)
+	if err != nil {
+		return nil, opts.failed(PhaseCoreImports, err)
+	}
+	result.CorePackages = corePackages
+	result.DeprecatedIdentifiers = removedIdentsInUse
+	for _, pkg := range corePackages {
+		opts.found(PhaseCoreImports, FindingCorePackage, pkg)
+	}
+	for _, offence := range removedIdentsInUse {
+		opts.found(PhaseCoreImports, FindingDeprecatedIdentifier, offence)
+	}
+	opts.finished(PhaseCoreImports, nil)
+	return result, nil
+}
+
+func CheckGoVersion(pluginPath string) (goVersion string, satisfiesConstraint bool) {
+	c, err := version.NewConstraint(GoVersionConstraint)
+
+	runtimeVersion := strings.TrimLeft(runtime.Version(), "go")
+	v, err := version.NewVersion(runtimeVersion)
+	if err != nil {
+		log.Printf("[WARN] Could not parse Go version %s", runtimeVersion)
+		return "", false
+	}
+
+	return runtimeVersion, c.Check(v)
+}
+
+func CheckForGoModules(pluginPath string) (usingModules bool) {
+	if _, err := os.Stat(filepath.Join(pluginPath, "go.mod")); err != nil {
+		log.Printf("[WARN] 'go.mod' file not found - plugin %s is not using Go modules", pluginPath)
+		return false
+	}
+	return true
+}
+
+func CheckSDKPackageImportsAndRefs(ctx context.Context, pluginPath string, rules *util.Rules) (corePackages []*CorePackage, packageRefsOffences []*Offence, err error) {
+	var pluginImportDetails *pluginImportDetails
+
+	pluginImportDetails, err = GoListPackageImports(ctx, pluginPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	corePackages, err = CheckSDKPackageImports(pluginImportDetails, rules)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	packageRefsOffences, err = CheckSDKPackageRefs(pluginImportDetails, rules)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return
+}
@@ -0,0 +1,268 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package migrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/hashicorp/packer-sdk-migrator/util"
+)
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	EventPhaseStarted  EventType = "phase_started"
+	EventPhaseFinished EventType = "phase_finished"
+	EventFileRewritten EventType = "file_rewritten"
+	EventFinding       EventType = "finding"
+)
+
+// Event reports the progress of Check and Migrate to an Observer.
+type Event struct {
+	Type EventType
+	// Phase is the phase started or finished, or the phase during which a
+	// file was rewritten or a finding was emitted.
+	Phase string
+
+	// Err is the error a phase failed with, for EventPhaseFinished. For the
+	// phases of Migrate, it is the *PhaseError also returned by Migrate.
+	Err error
+	// Result is the outcome of a finished phase, if any: the *CheckResult
+	// of PhaseCheck, the SDK version go.mod requires for PhaseGoMod, and the
+	// *util.BackupManifest of PhaseBackup.
+	Result interface{}
+
+	// Change is the file written, for EventFileRewritten.
+	Change *util.FileChange
+
+	// Finding is the finding emitted, for EventFinding.
+	Finding *Finding
+}
+
+// FindingKind is the kind of a Finding, which determines the type of its
+// value.
+type FindingKind string
+
+const (
+	// FindingGoVersion is a *VersionCheck of the Go runtime.
+	FindingGoVersion FindingKind = "go_version"
+	// FindingGoModules is a bool telling whether the plugin uses Go modules.
+	FindingGoModules FindingKind = "go_modules"
+	// FindingSDKVersion is a *VersionCheck of the SDK.
+	FindingSDKVersion FindingKind = "sdk_version"
+	// FindingPackerVersion is a *VersionCheck of the Packer core.
+	FindingPackerVersion FindingKind = "packer_version"
+	// FindingCorePackage is a *CorePackage imported by the plugin.
+	FindingCorePackage FindingKind = "core_package"
+	// FindingDeprecatedIdentifier is an *Offence.
+	FindingDeprecatedIdentifier FindingKind = "deprecated_identifier"
+	// FindingFile is the *FileMigration of a Go file importing Packer core
+	// or SDK packages.
+	FindingFile FindingKind = "file"
+	// FindingPartiallyMigrated is the []*FileMigration of the files still
+	// importing Packer core packages in a plugin depending on the SDK.
+	FindingPartiallyMigrated FindingKind = "partially_migrated"
+
+	// FindingMigrationInProgress is the *util.Journal of a migration in
+	// progress.
+	FindingMigrationInProgress FindingKind = "migration_in_progress"
+	// FindingResumed is the *util.Journal of the migration resumed.
+	FindingResumed FindingKind = "resumed"
+	// FindingStaleTempFile is the path of a temporary file left by a
+	// migration which died while writing files, removed when resuming it.
+	FindingStaleTempFile FindingKind = "stale_temp_file"
+	// FindingIgnoredCheck is the error of a failed eligibility check,
+	// ignored because the migration is forced.
+	FindingIgnoredCheck FindingKind = "ignored_check"
+	// FindingSkippedReference is a *util.SkippedReference.
+	FindingSkippedReference FindingKind = "skipped_reference"
+	// FindingAlias is a *util.AliasDecision.
+	FindingAlias FindingKind = "alias"
+	// FindingMappingError is a *util.MappingError explaining a go mod tidy
+	// failure.
+	FindingMappingError FindingKind = "mapping_error"
+	// FindingVendored is emitted, with the value true, if the plugin vendors
+	// its dependencies.
+	FindingVendored FindingKind = "vendored"
+	// FindingVerifyStep is the *util.VerifyStep of a verification command.
+	FindingVerifyStep FindingKind = "verify_step"
+)
+
+// Finding is something found about the plugin while checking or migrating it.
+type Finding struct {
+	Kind  FindingKind
+	Value interface{}
+}
+
+// Observer is notified of the events of Check and Migrate, in order, from the
+// goroutine they were called in.
+type Observer interface {
+	Observe(e *Event)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(e *Event)
+
+func (f ObserverFunc) Observe(e *Event) {
+	f(e)
+}
+
+// emit notifies the observer of the options, if any.
+func (o *Options) emit(e *Event) {
+	if o.Observer != nil {
+		o.Observer.Observe(e)
+	}
+}
+
+func (o *Options) started(phase string) {
+	o.emit(&Event{Type: EventPhaseStarted, Phase: phase})
+}
+
+func (o *Options) finished(phase string, result interface{}) {
+	o.emit(&Event{Type: EventPhaseFinished, Phase: phase, Result: result})
+}
+
+// failed reports that the phase failed with err, and returns err.
+func (o *Options) failed(phase string, err error) error {
+	o.emit(&Event{Type: EventPhaseFinished, Phase: phase, Err: err})
+	return err
+}
+
+func (o *Options) found(phase string, kind FindingKind, value interface{}) {
+	o.emit(&Event{Type: EventFinding, Phase: phase, Finding: &Finding{kind, value}})
+}
+
+// jsonLinesObserver writes every event as a line of JSON.
+type jsonLinesObserver struct {
+	enc     *json.Encoder
+	baseDir string
+}
+
+// NewJSONLinesObserver returns an Observer writing each event to w as a JSON
+// object on its own line. File names are made relative to baseDir.
+func NewJSONLinesObserver(w io.Writer, baseDir string) Observer {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonLinesObserver{enc: enc, baseDir: baseDir}
+}
+
+type jsonEvent struct {
+	Type    EventType   `json:"type"`
+	Phase   string      `json:"phase,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	File    string      `json:"file,omitempty"`
+	Backup  string      `json:"backup,omitempty"`
+	Kind    FindingKind `json:"kind,omitempty"`
+	Finding interface{} `json:"finding,omitempty"`
+}
+
+func (o *jsonLinesObserver) Observe(e *Event) {
+	je := &jsonEvent{Type: e.Type, Phase: e.Phase}
+	if e.Err != nil {
+		je.Error = e.Err.Error()
+	}
+	if backup, ok := e.Result.(*util.BackupManifest); ok {
+		je.Backup = backup.ID
+	}
+	if e.Change != nil {
+		je.File = o.relPath(e.Change.Path)
+	}
+	if e.Finding != nil {
+		je.Kind = e.Finding.Kind
+		je.Finding = o.findingJSON(e.Finding.Value)
+	}
+
+	o.enc.Encode(je)
+}
+
+// findingJSON returns the JSON representation of the value of a finding.
+// Identifiers are reported by name, and positions as strings.
+func (o *jsonLinesObserver) findingJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *CorePackage:
+		targets := v.Targets
+		if targets == nil {
+			targets = []string{}
+		}
+		files := []string{}
+		for _, f := range v.Files {
+			files = append(files, o.relPath(f))
+		}
+		return map[string]interface{}{
+			"import_path": v.ImportPath,
+			"status":      v.Status.String(),
+			"targets":     targets,
+			"files":       files,
+		}
+	case *Offence:
+		positions := []string{}
+		for _, pos := range v.Positions {
+			p := *pos
+			p.Filename = o.relPath(p.Filename)
+			positions = append(positions, p.String())
+		}
+		return map[string]interface{}{
+			"identifier":  v.IdentDeprecation.Identifier.Name,
+			"import_path": v.IdentDeprecation.ImportPath,
+			"message":     v.IdentDeprecation.Message,
+			"replacement": v.IdentDeprecation.Replacement,
+			"positions":   positions,
+		}
+	case *FileMigration:
+		return o.fileJSON(v)
+	case []*FileMigration:
+		files := []interface{}{}
+		for _, f := range v {
+			files = append(files, o.fileJSON(f))
+		}
+		return files
+	case *util.Journal:
+		return map[string]interface{}{
+			"backup_id":  v.BackupID,
+			"started_at": v.StartedAt,
+			"phases":     v.Phases,
+			"written":    v.Written(),
+			"files":      len(v.Files),
+		}
+	case *util.VerifyStep:
+		errors := []string{}
+		for _, ce := range v.Errors {
+			errors = append(errors, ce.String())
+		}
+		return map[string]interface{}{
+			"command": v.Command,
+			"passed":  v.Passed(),
+			"errors":  errors,
+		}
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+func (o *jsonLinesObserver) fileJSON(f *FileMigration) interface{} {
+	core := f.CorePackages
+	if core == nil {
+		core = []string{}
+	}
+	return map[string]interface{}{
+		"file":          o.relPath(f.Path),
+		"status":        f.Status,
+		"core_packages": core,
+	}
+}
+
+func (o *jsonLinesObserver) relPath(path string) string {
+	rel, err := filepath.Rel(o.baseDir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package migrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_Migrate_events(t *testing.T) {
+	dir := testPlugin(t, map[string]string{
+		"go.mod": "module example.com/plugin\n\ngo 1.16\n\nrequire " + PackerModPath + " v1.6.5\n",
+		"main.go": `package main
+
+import "github.com/hashicorp/packer/provisioner"
+
+var _ = provisioner.GuestOSType("")
+
+func main() {}
+`,
+	})
+
+	var phases []string
+	var findings []FindingKind
+	observer := ObserverFunc(func(e *Event) {
+		switch e.Type {
+		case EventPhaseStarted:
+			phases = append(phases, e.Phase)
+		case EventPhaseFinished:
+			if e.Err != nil {
+				t.Errorf("phase %s failed: %s", e.Phase, e.Err)
+			}
+			if e.Phase == PhaseCheck {
+				if _, ok := e.Result.(*CheckResult); !ok {
+					t.Errorf("expected the *CheckResult of the check, got %T", e.Result)
+				}
+			}
+		case EventFinding:
+			findings = append(findings, e.Finding.Kind)
+		}
+	})
+
+	_, err := Migrate(context.Background(), Options{PluginPath: dir, DryRun: true, Force: true, Observer: observer})
+	if err != nil {
+		t.Fatalf("Migrate: %s", err)
+	}
+
+	expectedPhases := []string{
+		PhaseCheck, PhaseJournal, PhaseGoVersion, PhaseGoModules, PhaseSDKVersion, PhaseFiles, PhasePackerVersion, PhaseCoreImports,
+		PhaseGoMod, PhaseImports,
+	}
+	if !reflect.DeepEqual(phases, expectedPhases) {
+		t.Fatalf("expected phases %q, got %q", expectedPhases, phases)
+	}
+	expectedFindings := []FindingKind{
+		FindingGoVersion, FindingGoModules, FindingSDKVersion, FindingFile, FindingPackerVersion, FindingCorePackage,
+	}
+	if !reflect.DeepEqual(findings, expectedFindings) {
+		t.Fatalf("expected findings %q, got %q", expectedFindings, findings)
+	}
+}
+
+func Test_NewJSONLinesObserver(t *testing.T) {
+	var buf bytes.Buffer
+	observer := NewJSONLinesObserver(&buf, "/plugin")
+	observer.Observe(&Event{Type: EventPhaseStarted, Phase: PhaseCoreImports})
+	observer.Observe(&Event{Type: EventFinding, Phase: PhaseCoreImports, Finding: &Finding{
+		Kind: FindingCorePackage,
+		Value: &CorePackage{
+			ImportPath: PackerModPath + "/version",
+			Status:     PackageRemoved,
+			Files:      []string{"/plugin/main.go"},
+		},
+	}})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got:\n%s", buf.String())
+	}
+	var event struct {
+		Type    EventType
+		Kind    FindingKind
+		Finding map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if event.Type != EventFinding || event.Kind != FindingCorePackage {
+		t.Fatalf("unexpected event: %s", lines[1])
+	}
+	expected := map[string]interface{}{
+		"import_path": PackerModPath + "/version",
+		"status":      "no SDK equivalent",
+		"targets":     []interface{}{},
+		"files":       []interface{}{"main.go"},
+	}
+	if !reflect.DeepEqual(event.Finding, expected) {
+		t.Fatalf("expected finding %v, got %v", expected, event.Finding)
+	}
+}
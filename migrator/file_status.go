@@ -0,0 +1,127 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package migrator
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer-sdk-migrator/util"
+)
+
+// FileStatus is the migration status of a Go file of the plugin.
+type FileStatus string
+
+const (
+	// FileCoreOnly files import Packer core packages only.
+	FileCoreOnly FileStatus = "core-only"
+	// FileSDKOnly files import SDK packages only.
+	FileSDKOnly FileStatus = "sdk-only"
+	// FileMixed files import both Packer core and SDK packages.
+	FileMixed FileStatus = "mixed"
+)
+
+// FileMigration is the migration status of a Go file importing Packer core
+// or SDK packages.
+type FileMigration struct {
+	Path   string
+	Status FileStatus
+	// CorePackages lists the Packer core packages imported by the file,
+	// sorted by import path.
+	CorePackages []string
+}
+
+// Migrated reports whether the file imports no Packer core package.
+func (f *FileMigration) Migrated() bool {
+	return f.Status == FileSDKOnly
+}
+
+// CheckFileMigrations returns the migration status of every Go file of the
+// plugin importing Packer core or SDK packages, sorted by path. Vendored
+// files are skipped, like they are by the migration.
+func CheckFileMigrations(ctx context.Context, pluginPath string) ([]*FileMigration, error) {
+	files := []*FileMigration{}
+	err := filepath.Walk(pluginPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == "vendor" || info.Name() == util.StateDir) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") {
+			return nil
+		}
+		file, err := fileMigration(path)
+		if err != nil {
+			return err
+		}
+		if file != nil {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// Stragglers returns the files which still import Packer core packages.
+func Stragglers(files []*FileMigration) []*FileMigration {
+	stragglers := []*FileMigration{}
+	for _, f := range files {
+		if !f.Migrated() {
+			stragglers = append(stragglers, f)
+		}
+	}
+	return stragglers
+}
+
+func fileMigration(path string) (*FileMigration, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	var core []string
+	sdk := false
+	for _, imp := range f.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(importPath, PackerModPath+"/"):
+			if !util.StringSliceContains(core, importPath) {
+				core = append(core, importPath)
+			}
+		case importPath == SDKModPath || strings.HasPrefix(importPath, SDKModPath+"/"):
+			sdk = true
+		}
+	}
+
+	file := &FileMigration{Path: path, CorePackages: core}
+	switch {
+	case len(core) > 0 && sdk:
+		file.Status = FileMixed
+	case len(core) > 0:
+		file.Status = FileCoreOnly
+	case sdk:
+		file.Status = FileSDKOnly
+	default:
+		return nil, nil
+	}
+	sort.Strings(file.CorePackages)
+	return file, nil
+}
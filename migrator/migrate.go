@@ -0,0 +1,455 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/packer-sdk-migrator/util"
+)
+
+// Phases of a migration, as reported by PhaseError and to the Observer.
+const (
+	PhaseGoMod   = "rewriting go.mod file"
+	PhaseImports = "rewriting SDK imports"
+	PhaseBackup  = "backing up files"
+	PhaseStage   = "staging changes"
+	PhaseWrite   = "writing changes"
+	PhaseTidy    = "running go mod tidy"
+	PhaseVendor  = "checking vendor folder"
+	PhaseVerify  = "verifying plugin"
+	PhaseResume  = "resuming migration"
+)
+
+// MigrationResult is the outcome of a migration.
+type MigrationResult struct {
+	// Check is the result of the eligibility check, or nil if the check
+	// could not be completed.
+	Check *CheckResult
+	// CheckErr is the reason the plugin failed the eligibility check, if the
+	// migration was forced anyway.
+	CheckErr error
+
+	// SDKVersion is the SDK version go.mod requires once migrated.
+	SDKVersion  string
+	GoModChange *util.FileChange
+	// ImportChanges lists the Go files whose imports are rewritten.
+	ImportChanges []*util.FileChange
+
+	// Backup is the backup of the files modified by the migration. It is
+	// nil for dry runs.
+	Backup *util.BackupManifest
+	// MappingErrors explains the failure of go mod tidy, if it was caused
+	// by mapping rules.
+	MappingErrors []*util.MappingError
+	// Vendored is set if the plugin vendors its dependencies, in which case
+	// `go mod vendor` has to be run.
+	Vendored bool
+	// Verification holds the results of the commands run if
+	// Options.Verify is set.
+	Verification []*util.VerifyStep
+}
+
+// Changes returns every file change of the migration, starting with go.mod.
+func (r *MigrationResult) Changes() []*util.FileChange {
+	changes := []*util.FileChange{}
+	if r.GoModChange != nil {
+		changes = append(changes, r.GoModChange)
+	}
+	return append(changes, r.ImportChanges...)
+}
+
+// Skipped returns the references which could not be rewritten safely.
+func (r *MigrationResult) Skipped() []*util.SkippedReference {
+	skipped := []*util.SkippedReference{}
+	for _, change := range r.ImportChanges {
+		skipped = append(skipped, change.Skipped...)
+	}
+	return skipped
+}
+
+// Aliases returns the imports given an alias to avoid conflicting names.
+func (r *MigrationResult) Aliases() []*util.AliasDecision {
+	aliases := []*util.AliasDecision{}
+	for _, change := range r.ImportChanges {
+		aliases = append(aliases, change.Aliases...)
+	}
+	return aliases
+}
+
+// Annotations returns the number of TODO comments inserted, and the number of
+// files they were inserted in.
+func (r *MigrationResult) Annotations() (count, files int) {
+	for _, change := range r.ImportChanges {
+		if change.Annotations > 0 {
+			count += change.Annotations
+			files++
+		}
+	}
+	return count, files
+}
+
+// Verified reports whether every verification command succeeded. It is
+// false if the plugin was not verified.
+func (r *MigrationResult) Verified() bool {
+	if len(r.Verification) == 0 {
+		return false
+	}
+	for _, step := range r.Verification {
+		if !step.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Migrate migrates the plugin to the SDK: go.mod is rewritten to depend on
+// the SDK instead of the Packer core, the imports of every Go file are
+// rewritten according to the mapping rules, and `go mod tidy` is run.
+//
+// The plugin must pass the eligibility check, unless the migration is forced;
+// otherwise an *EligibilityError is returned together with the result of the
+// check. The modified files are backed up first, and the changes are applied
+// as a transaction: if any phase fails, a *PhaseError is returned and every
+// change is rolled back. A failed verification is not an error; see
+// MigrationResult.Verified. The progress of every phase, including those of
+// the check, is reported to Options.Observer.
+//
+// External commands are killed once ctx is done, and files are only written
+// while it is not. A migration cancelled before go mod tidy succeeded is
+// rolled back; once it succeeded, the migration is kept.
+//
+// Until go mod tidy succeeded, the progress of the migration is recorded in a
+// journal in the plugin directory. If the migration dies, it is reported by
+// Check, and can be resumed by setting Options.Resume; even forced
+// migrations are refused until then.
+func Migrate(ctx context.Context, opts Options) (*MigrationResult, error) {
+	if opts.Resume {
+		return resume(ctx, &opts)
+	}
+	customRules := opts.Rules != nil
+	rules, err := opts.rules()
+	if err != nil {
+		return nil, err
+	}
+	opts.Rules = rules
+	pluginPath := opts.PluginPath
+	result := &MigrationResult{}
+
+	result.Check, err = Check(ctx, opts)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if err == nil {
+		err = result.Check.Err()
+	}
+	var inProgress *MigrationInProgress
+	if err != nil {
+		if !opts.Force || errors.As(err, &inProgress) {
+			return result, NewEligibilityError(err)
+		}
+		result.CheckErr = err
+		opts.found(PhaseCheck, FindingIgnoredCheck, err)
+	}
+
+	// A partially migrated plugin keeps the SDK version it requires, and is
+	// migrated with the mapping rules of that version.
+	if check := result.Check; check != nil && check.PartiallyMigrated {
+		required := "v" + check.SDKVersion.Version
+		if opts.SDKVersion != "" && !sameVersion(opts.SDKVersion, required) {
+			return result, NewEligibilityError(&SDKVersionMismatch{Required: required, Requested: opts.SDKVersion})
+		}
+		opts.SDKVersion = required
+		if !customRules {
+			opts.Rules = nil
+			if rules, err = opts.rules(); err != nil {
+				return result, NewEligibilityError(err)
+			}
+			opts.Rules = rules
+		}
+	}
+	result.SDKVersion = opts.sdkVersion()
+
+	// fail reports that the phase failed, before anything was written.
+	fail := func(phase string, err error) error {
+		return opts.failed(phase, NewPhaseError(phase, err))
+	}
+
+	opts.started(PhaseGoMod)
+	result.GoModChange, err = util.GoModChange(pluginPath, result.SDKVersion, PackerModPath, SDKModPath)
+	if err != nil {
+		return result, fail(PhaseGoMod, err)
+	}
+	opts.finished(PhaseGoMod, result.SDKVersion)
+
+	opts.started(PhaseImports)
+	result.ImportChanges, err = util.PluginImportsChanges(ctx, pluginPath, rules, &opts.Imports)
+	if err != nil {
+		return result, fail(PhaseImports, err)
+	}
+	for _, s := range result.Skipped() {
+		opts.found(PhaseImports, FindingSkippedReference, s)
+	}
+	for _, a := range result.Aliases() {
+		opts.found(PhaseImports, FindingAlias, a)
+	}
+	opts.finished(PhaseImports, nil)
+	if opts.DryRun {
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	opts.started(PhaseBackup)
+	goSumPath := filepath.Join(pluginPath, "go.sum")
+	backupPaths := []string{result.GoModChange.Path, goSumPath}
+	for _, change := range result.ImportChanges {
+		backupPaths = append(backupPaths, change.Path)
+	}
+	result.Backup, err = util.CreateBackup(pluginPath, backupPaths)
+	if err != nil {
+		return result, fail(PhaseBackup, err)
+	}
+	written := []*util.FileChange{}
+	for _, change := range result.Changes() {
+		if change.Changed() {
+			written = append(written, change)
+		}
+	}
+	journal, err := util.CreateJournal(pluginPath, result.Backup.ID, result.SDKVersion, written)
+	if err != nil {
+		return result, fail(PhaseBackup, err)
+	}
+
+	// All changes are staged before anything is written, and every phase
+	// from here on rolls back the whole migration if it fails. The journal
+	// is only kept if the rollback fails.
+	tx := util.NewTransaction()
+	tx.Written = journal.FileWritten
+	rollback := func(phase string, err error) error {
+		pe := NewPhaseError(phase, err)
+		pe.RolledBack = true
+		pe.RollbackErr = tx.Rollback()
+		pe.Backup = result.Backup
+		if pe.RollbackErr == nil {
+			journal.Remove()
+		}
+		return opts.failed(phase, pe)
+	}
+	err = tx.Track(goSumPath)
+	if err == nil {
+		err = journal.Complete(PhaseBackup)
+	}
+	if err != nil {
+		return result, rollback(PhaseBackup, err)
+	}
+	opts.finished(PhaseBackup, result.Backup)
+
+	opts.started(PhaseStage)
+	for _, change := range written {
+		if err := ctx.Err(); err != nil {
+			return result, rollback(PhaseStage, err)
+		}
+		if err := tx.Stage(change); err != nil {
+			return result, rollback(PhaseStage, fmt.Errorf("%s: %w", change.Path, err))
+		}
+	}
+	opts.finished(PhaseStage, nil)
+
+	opts.started(PhaseWrite)
+	err = tx.Commit(ctx)
+	if err == nil {
+		err = journal.Complete(PhaseWrite)
+	}
+	if err != nil {
+		return result, rollback(PhaseWrite, err)
+	}
+	for _, change := range written {
+		opts.emit(&Event{Type: EventFileRewritten, Phase: PhaseWrite, Change: change})
+	}
+	opts.finished(PhaseWrite, nil)
+
+	return result, complete(ctx, &opts, result, journal, rollback)
+}
+
+// complete runs go mod tidy once every file is written, rolling the migration
+// back if it fails, and then checks and verifies the migrated plugin.
+func complete(ctx context.Context, opts *Options, result *MigrationResult, journal *util.Journal, rollback func(string, error) error) error {
+	pluginPath := opts.PluginPath
+	fail := func(phase string, err error) error {
+		return opts.failed(phase, NewPhaseError(phase, err))
+	}
+
+	opts.started(PhaseTidy)
+	err := util.GoModTidy(ctx, pluginPath)
+	if err != nil {
+		if execErr, ok := err.(*util.ExecError); ok {
+			result.MappingErrors = util.DiagnoseTidyError(execErr.Stderr, opts.Rules, result.ImportChanges)
+		}
+		for _, me := range result.MappingErrors {
+			opts.found(PhaseTidy, FindingMappingError, me)
+		}
+		return rollback(PhaseTidy, err)
+	}
+	// The migration is complete: later failures do not roll it back.
+	if err := journal.Remove(); err != nil {
+		log.Printf("[WARN] Could not remove the migration journal: %s", err)
+	}
+	opts.finished(PhaseTidy, nil)
+
+	opts.started(PhaseVendor)
+	result.Vendored, err = util.HasVendorFolder(pluginPath)
+	if err != nil {
+		return fail(PhaseVendor, err)
+	}
+	if result.Vendored {
+		opts.found(PhaseVendor, FindingVendored, true)
+	}
+	opts.finished(PhaseVendor, nil)
+
+	if opts.Verify {
+		opts.started(PhaseVerify)
+		result.Verification, err = util.Verify(ctx, pluginPath, result.ImportChanges)
+		if err != nil {
+			return fail(PhaseVerify, err)
+		}
+		for _, step := range result.Verification {
+			opts.found(PhaseVerify, FindingVerifyStep, step)
+		}
+		opts.finished(PhaseVerify, nil)
+	}
+	return nil
+}
+
+// resume resumes the migration recorded in the journal of the plugin. Files
+// which were not written yet are written from the journal. If any phase
+// fails, the plugin is restored from the backup of the migration.
+func resume(ctx context.Context, opts *Options) (*MigrationResult, error) {
+	pluginPath := opts.PluginPath
+	result := &MigrationResult{}
+
+	opts.started(PhaseResume)
+	journal, err := util.ReadJournal(pluginPath)
+	if err == nil && journal == nil {
+		err = ErrNoMigrationInProgress
+	}
+	if err != nil {
+		return result, opts.failed(PhaseResume, err)
+	}
+	opts.found(PhaseResume, FindingResumed, journal)
+
+	// The mapping rules of the version migrated to explain failures of the
+	// remaining phases, falling back to the newest known rules.
+	result.SDKVersion = journal.SDKVersion
+	if opts.Rules == nil {
+		opts.SDKVersion = journal.SDKVersion
+		if opts.Rules, err = opts.rules(); err != nil {
+			opts.Rules = opts.ruleSet().Latest()
+		}
+	}
+
+	result.Backup, err = util.ReadBackupManifest(pluginPath, journal.BackupID)
+	if err != nil {
+		return result, opts.failed(PhaseBackup, NewPhaseError(PhaseBackup, err))
+	}
+	// The changes are rebuilt from the journal, so that failures of the
+	// remaining phases are explained as if the migration never died.
+	for _, f := range journal.Files {
+		change, err := journal.Change(f, result.Backup)
+		if err != nil {
+			return result, opts.failed(PhaseResume, err)
+		}
+		if change.Path == filepath.Join(pluginPath, "go.mod") {
+			result.GoModChange = change
+		} else {
+			result.ImportChanges = append(result.ImportChanges, change)
+		}
+
+		// Files staged by a migration which died while writing them are
+		// left next to the plugin sources.
+		stale, err := util.RemoveTempFiles(change.Path)
+		if err != nil {
+			return result, opts.failed(PhaseResume, err)
+		}
+		for _, path := range stale {
+			opts.found(PhaseResume, FindingStaleTempFile, path)
+		}
+	}
+	opts.finished(PhaseResume, nil)
+	rollback := func(phase string, err error) error {
+		pe := NewPhaseError(phase, err)
+		pe.RolledBack = true
+		pe.RollbackErr = util.RestoreBackup(pluginPath, result.Backup)
+		pe.Backup = result.Backup
+		if pe.RollbackErr == nil {
+			journal.Remove()
+		}
+		return opts.failed(phase, pe)
+	}
+
+	if !journal.Completed(PhaseWrite) {
+		opts.started(PhaseWrite)
+		changes := map[string]*util.FileChange{}
+		for _, change := range result.Changes() {
+			changes[change.Path] = change
+		}
+		originals := map[string]*util.BackupFile{}
+		for _, f := range result.Backup.Files {
+			originals[f.Path] = f
+		}
+		for _, f := range journal.Files {
+			if f.Written {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return result, rollback(PhaseWrite, err)
+			}
+			path := filepath.Join(pluginPath, filepath.FromSlash(f.Path))
+			current, err := ioutil.ReadFile(path)
+			if err != nil {
+				return result, rollback(PhaseWrite, err)
+			}
+			if !f.MatchesContent(current) {
+				// Files modified since the migration started are left
+				// alone, and so is the rest of the plugin.
+				if orig := originals[f.Path]; orig == nil || !orig.MatchesContent(current) {
+					return result, opts.failed(PhaseWrite, NewPhaseError(PhaseWrite,
+						fmt.Errorf("%s was modified since the migration started", f.Path)))
+				}
+				content, err := journal.Content(f)
+				if err == nil {
+					err = util.WriteFileAtomic(path, content, filePerm(path))
+				}
+				if err != nil {
+					return result, rollback(PhaseWrite, err)
+				}
+			}
+			if err := journal.FileWritten(path); err != nil {
+				return result, rollback(PhaseWrite, err)
+			}
+			opts.emit(&Event{Type: EventFileRewritten, Phase: PhaseWrite, Change: changes[path]})
+		}
+		if err := journal.Complete(PhaseWrite); err != nil {
+			return result, rollback(PhaseWrite, err)
+		}
+		opts.finished(PhaseWrite, nil)
+	}
+
+	return result, complete(ctx, opts, result, journal, rollback)
+}
+
+// filePerm returns the permissions of the file at path, defaulting to 0644.
+func filePerm(path string) os.FileMode {
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
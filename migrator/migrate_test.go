@@ -0,0 +1,276 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package migrator
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-sdk-migrator/util"
+)
+
+// testPlugin writes the files of a plugin to a temporary directory.
+func testPlugin(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "packer-sdk-migrator")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	return dir
+}
+
+func Test_Check_alreadyMigrated(t *testing.T) {
+	dir := testPlugin(t, map[string]string{
+		"go.mod":  "module example.com/plugin\n\ngo 1.16\n\nrequire " + SDKModPath + " v0.0.14\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	})
+
+	result, err := Check(context.Background(), Options{PluginPath: dir})
+	if err != nil {
+		t.Fatalf("Check: %s", err)
+	}
+	if !result.AlreadyMigrated || result.SDKVersion.Version != "0.0.14" {
+		t.Fatalf("expected the plugin to be migrated already, got %+v", result)
+	}
+	var alreadyMigrated *AlreadyMigrated
+	if !errors.As(result.Err(), &alreadyMigrated) {
+		t.Fatalf("expected *AlreadyMigrated, got %v", result.Err())
+	}
+
+	// Migrating it again is refused.
+	migration, err := Migrate(context.Background(), Options{PluginPath: dir})
+	var eligibilityErr *EligibilityError
+	if !errors.As(err, &eligibilityErr) {
+		t.Fatalf("expected *EligibilityError, got %v", err)
+	}
+	if migration.Check == nil || migration.GoModChange != nil {
+		t.Fatalf("unexpected migration result: %+v", migration)
+	}
+}
+
+func Test_Check_partiallyMigrated(t *testing.T) {
+	dir := testPlugin(t, map[string]string{
+		"go.mod": "module example.com/plugin\n\ngo 1.16\n\nrequire " + SDKModPath + " v0.0.14\n",
+		"main.go": `package main
+
+import "github.com/hashicorp/packer-plugin-sdk/guestexec"
+
+var _ = guestexec.GuestOSType("")
+
+func main() {}
+`,
+		"step.go": `package main
+
+import (
+	"github.com/hashicorp/packer-plugin-sdk/guestexec"
+	"github.com/hashicorp/packer/provisioner"
+)
+
+var _ = guestexec.GuestOSType("")
+var _ = provisioner.GuestOSType("")
+`,
+		"other.go": "package main\n\nimport _ \"github.com/hashicorp/packer/provisioner\"\n",
+	})
+
+	result, err := Check(context.Background(), Options{PluginPath: dir})
+	if err != nil {
+		t.Fatalf("Check: %s", err)
+	}
+	if result.AlreadyMigrated || !result.PartiallyMigrated {
+		t.Fatalf("expected the plugin to be partially migrated, got %+v", result)
+	}
+	if err := result.Err(); err != nil {
+		t.Fatalf("expected a partially migrated plugin to be migratable, got %v", err)
+	}
+	statuses := map[string]FileStatus{}
+	for _, f := range result.Files {
+		statuses[filepath.Base(f.Path)] = f.Status
+	}
+	expected := map[string]FileStatus{"main.go": FileSDKOnly, "step.go": FileMixed, "other.go": FileCoreOnly}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("expected file statuses %v, got %v", expected, statuses)
+	}
+	if len(result.Stragglers()) != 2 {
+		t.Fatalf("expected 2 stragglers, got %d", len(result.Stragglers()))
+	}
+
+	migration, err := Migrate(context.Background(), Options{PluginPath: dir, DryRun: true})
+	if err != nil {
+		t.Fatalf("Migrate: %s", err)
+	}
+	if len(migration.ImportChanges) != 2 {
+		t.Fatalf("expected the stragglers to be rewritten, got %d changes", len(migration.ImportChanges))
+	}
+	if migration.SDKVersion != "v0.0.14" || !strings.Contains(string(migration.GoModChange.Updated), SDKModPath+" v0.0.14") {
+		t.Fatalf("expected the SDK version required to be kept, got %s:\n%s", migration.SDKVersion, migration.GoModChange.Updated)
+	}
+
+	// Another SDK version is refused.
+	_, err = Migrate(context.Background(), Options{PluginPath: dir, DryRun: true, SDKVersion: "v0.0.12"})
+	var mismatch *SDKVersionMismatch
+	if !errors.As(err, &mismatch) || mismatch.Required != "v0.0.14" {
+		t.Fatalf("expected *SDKVersionMismatch, got %v", err)
+	}
+}
+
+func Test_Migrate_dryRun(t *testing.T) {
+	dir := testPlugin(t, map[string]string{
+		"go.mod": "module example.com/plugin\n\ngo 1.16\n\nrequire " + PackerModPath + " v1.6.5\n",
+		"main.go": `package main
+
+import "github.com/hashicorp/packer/provisioner"
+
+var _ = provisioner.GuestOSType("")
+
+func main() {}
+`,
+	})
+
+	result, err := Migrate(context.Background(), Options{PluginPath: dir, DryRun: true, Force: true})
+	if err != nil {
+		t.Fatalf("Migrate: %s", err)
+	}
+	if result.Backup != nil {
+		t.Fatalf("unexpected backup for a dry run")
+	}
+	if len(result.ImportChanges) != 1 || !strings.Contains(string(result.ImportChanges[0].Updated), "guestexec.GuestOSType") {
+		t.Fatalf("unexpected import changes: %v", result.ImportChanges)
+	}
+	if !strings.Contains(string(result.GoModChange.Updated), SDKModPath) {
+		t.Fatalf("unexpected go.mod change:\n%s", result.GoModChange.Updated)
+	}
+
+	// Nothing is written.
+	content, err := ioutil.ReadFile(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if !strings.Contains(string(content), "provisioner.GuestOSType") {
+		t.Fatalf("main.go was modified by a dry run:\n%s", content)
+	}
+}
+
+func Test_Migrate_cancelled(t *testing.T) {
+	dir := testPlugin(t, map[string]string{
+		"go.mod":  "module example.com/plugin\n\ngo 1.16\n\nrequire " + PackerModPath + " v1.6.5\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Migrate(ctx, Options{PluginPath: dir, Force: true})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if strings.Contains(string(content), SDKModPath) {
+		t.Fatalf("go.mod was modified by a cancelled migration:\n%s", content)
+	}
+}
+
+func Test_Migrate_resume(t *testing.T) {
+	dir := testPlugin(t, map[string]string{
+		"go.mod":   "module example.com/plugin\n\ngo 1.16\n",
+		"main.go":  "package main\n\nfunc main() {}\n",
+		"other.go": "package main\n\nfunc other() {}\n",
+	})
+	mainGo := filepath.Join(dir, "main.go")
+	otherGo := filepath.Join(dir, "other.go")
+	changes := []*util.FileChange{
+		{Path: mainGo, Original: []byte("package main\n\nfunc main() {}\n"), Updated: []byte("package main\n\n// migrated\nfunc main() {}\n")},
+		{
+			Path:     otherGo,
+			Original: []byte("package main\n\nfunc other() {}\n"),
+			Updated:  []byte("package main\n\n// migrated\nfunc other() {}\n"),
+			Rewrites: []*util.Rewrite{{Line: 4, From: PackerModPath + "/packer", To: SDKModPath + "/packer"}},
+		},
+	}
+
+	// Simulate a migration dying after writing main.go, before recording it.
+	backup, err := util.CreateBackup(dir, []string{mainGo, otherGo})
+	if err != nil {
+		t.Fatalf("CreateBackup: %s", err)
+	}
+	journal, err := util.CreateJournal(dir, backup.ID, "v0.0.14", changes)
+	if err != nil {
+		t.Fatalf("CreateJournal: %s", err)
+	}
+	if err := journal.Complete(PhaseBackup); err != nil {
+		t.Fatalf("Complete: %s", err)
+	}
+	if err := ioutil.WriteFile(mainGo, changes[0].Updated, 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	staged := filepath.Join(dir, ".other.go.tmp-123")
+	if err := ioutil.WriteFile(staged, changes[1].Updated, 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	check, err := Check(context.Background(), Options{PluginPath: dir})
+	if err != nil {
+		t.Fatalf("Check: %s", err)
+	}
+	var inProgress *MigrationInProgress
+	if !errors.As(check.Err(), &inProgress) {
+		t.Fatalf("expected *MigrationInProgress, got %v", check.Err())
+	}
+	_, err = Migrate(context.Background(), Options{PluginPath: dir, Force: true})
+	var eligibilityErr *EligibilityError
+	if !errors.As(err, &eligibilityErr) {
+		t.Fatalf("expected a new migration to be refused, got %v", err)
+	}
+
+	result, err := Migrate(context.Background(), Options{PluginPath: dir, Resume: true})
+	if err != nil {
+		t.Fatalf("Migrate: %s", err)
+	}
+	if result.Backup == nil || result.Backup.ID != backup.ID {
+		t.Fatalf("expected the backup of the migration, got %+v", result.Backup)
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Fatalf("expected the staged file to be removed, got %v", err)
+	}
+	if len(result.ImportChanges) != 2 {
+		t.Fatalf("expected the changes to be rebuilt from the journal, got %d", len(result.ImportChanges))
+	}
+	for i, change := range result.ImportChanges {
+		if string(change.Original) != string(changes[i].Original) || string(change.Updated) != string(changes[i].Updated) {
+			t.Fatalf("unexpected change of %s: %q -> %q", change.Path, change.Original, change.Updated)
+		}
+		if !reflect.DeepEqual(change.Rewrites, changes[i].Rewrites) {
+			t.Fatalf("unexpected rewrites of %s: %v", change.Path, change.Rewrites)
+		}
+	}
+	for _, change := range changes {
+		content, err := ioutil.ReadFile(change.Path)
+		if err != nil {
+			t.Fatalf("ReadFile: %s", err)
+		}
+		if string(content) != string(change.Updated) {
+			t.Fatalf("unexpected content of %s: %q", change.Path, content)
+		}
+	}
+	if journal, err := util.ReadJournal(dir); err != nil || journal != nil {
+		t.Fatalf("expected the journal to be removed, got %v, %v", journal, err)
+	}
+
+	_, err = Migrate(context.Background(), Options{PluginPath: dir, Resume: true})
+	if err != ErrNoMigrationInProgress {
+		t.Fatalf("expected ErrNoMigrationInProgress, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+// Package migrator checks whether Packer plugins can be migrated from the
+// Packer core module to the standalone Packer plugin SDK, and migrates them.
+// It implements the check and migrate commands, and can be embedded by other
+// tools: results are returned as values rather than printed.
+package migrator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/packer-sdk-migrator/util"
+)
+
+const (
+	// GoVersionConstraint is the Go version required to migrate a plugin.
+	GoVersionConstraint = ">=1.12"
+
+	// PackerModPath is the module path of the Packer core.
+	PackerModPath = "github.com/hashicorp/packer"
+	// PackerVersionConstraint is the version of the Packer core a plugin
+	// must depend on to be migrated.
+	PackerVersionConstraint = ">=1.5.0"
+
+	// SDKModPath is the module path of the Packer plugin SDK.
+	SDKModPath = "github.com/hashicorp/packer-plugin-sdk"
+	// SDKVersionConstraint is the SDK version of plugins which were already
+	// migrated.
+	SDKVersionConstraint = ">=0.0.11"
+)
+
+// Options configures Check and Migrate.
+type Options struct {
+	// PluginPath is the directory of the plugin.
+	PluginPath string
+
+	// SDKVersion is the SDK version to migrate to, defaulting to
+	// util.DefaultSDKVersion. A partially migrated plugin is migrated to the
+	// SDK version it requires already, which SDKVersion must match if set.
+	SDKVersion string
+	// RuleSet holds the mapping rules of every SDK version, defaulting to
+	// the built-in rules.
+	RuleSet *util.RuleSet
+	// Rules maps Packer core packages to SDK packages. If nil, the rules of
+	// RuleSet for the SDK version migrated to are used.
+	Rules *util.Rules
+
+	// Force migrates the plugin even if it fails the eligibility check, and
+	// falls back to the newest known rules if none are known for
+	// SDKVersion. The newest known rules are always used for branch names,
+	// such as master.
+	Force bool
+	// DryRun computes the changes without writing them or running any
+	// command.
+	DryRun bool
+	// Verify builds and vets the plugin, and compiles its tests, once it is
+	// migrated.
+	Verify bool
+
+	// Imports controls how the imports of the plugin files are rewritten.
+	Imports util.ImportsOptions
+	// Resume resumes the migration in progress recorded in the journal of
+	// the plugin, instead of starting a new one. The plugin is not checked,
+	// and the other options, except Verify, are ignored.
+	Resume bool
+
+	// Observer, if set, is notified of the progress of the check and the
+	// migration.
+	Observer Observer
+}
+
+func (o *Options) sdkVersion() string {
+	if o.SDKVersion == "" {
+		return util.DefaultSDKVersion
+	}
+	return o.SDKVersion
+}
+
+func (o *Options) ruleSet() *util.RuleSet {
+	if o.RuleSet == nil {
+		return util.DefaultRules()
+	}
+	return o.RuleSet
+}
+
+// rules returns the mapping rules to use.
+func (o *Options) rules() (*util.Rules, error) {
+	if o.Rules != nil {
+		return o.Rules, nil
+	}
+	rules, _, err := o.ruleSet().ForReference(o.sdkVersion())
+	if err != nil && o.Force {
+		return o.ruleSet().Latest(), nil
+	}
+	return rules, err
+}
+
+// ErrConstraintsNotSatisfied is returned by CheckResult.Err when the plugin
+// fails any of the constraints.
+var ErrConstraintsNotSatisfied = errors.New("\nSome constraints not satisfied. Please resolve these before migrating to the new SDK.")
+
+// AlreadyMigrated is returned by CheckResult.Err when the plugin already
+// depends on the SDK.
+type AlreadyMigrated struct {
+	SDKVersion string
+}
+
+func (am *AlreadyMigrated) Error() string {
+	return fmt.Sprintf("plugin already migrated to SDK version %s", am.SDKVersion)
+}
+
+// SDKVersionMismatch is returned by Migrate when a partially migrated plugin
+// requires another SDK version than the one requested.
+type SDKVersionMismatch struct {
+	Required  string
+	Requested string
+}
+
+func (svm *SDKVersionMismatch) Error() string {
+	return fmt.Sprintf("plugin partially migrated to SDK version %s, but SDK version %s was requested. "+
+		"Finish the migration with SDK version %s, or update go.mod to require SDK version %s first.",
+		svm.Required, svm.Requested, svm.Required, svm.Requested)
+}
+
+// ErrNoMigrationInProgress is returned by Migrate when resuming a migration
+// of a plugin without any migration in progress.
+var ErrNoMigrationInProgress = errors.New("no migration in progress to resume")
+
+// MigrationInProgress is returned by CheckResult.Err when a migration of the
+// plugin died halfway, as recorded by its journal.
+type MigrationInProgress struct {
+	Journal *util.Journal
+}
+
+func (mip *MigrationInProgress) Error() string {
+	return fmt.Sprintf("migration in progress since %s: %d of %d files were written. "+
+		"Finish it with `packer-sdk-migrator migrate --resume`, or roll it back with `packer-sdk-migrator restore --backup %s`.",
+		mip.Journal.StartedAt.Local().Format("2006-01-02 15:04:05"), mip.Journal.Written(), len(mip.Journal.Files), mip.Journal.BackupID)
+}
+
+// EligibilityError is returned by Migrate when the plugin fails the
+// eligibility check, unless the migration is forced.
+type EligibilityError struct {
+	Err error
+}
+
+func (ee *EligibilityError) Error() string {
+	return ee.Err.Error()
+}
+
+func (ee *EligibilityError) Unwrap() error {
+	return ee.Err
+}
+
+func NewEligibilityError(err error) *EligibilityError {
+	return &EligibilityError{err}
+}
+
+// PhaseError is returned by Migrate when a phase of the migration fails. If
+// files were written already, every change is rolled back and RolledBack is
+// set. If the rollback failed too, RollbackErr is set, and the plugin can be
+// restored from Backup.
+type PhaseError struct {
+	Phase       string
+	Err         error
+	RolledBack  bool
+	RollbackErr error
+	Backup      *util.BackupManifest
+}
+
+func (pe *PhaseError) Error() string {
+	return fmt.Sprintf("%s: %s", pe.Phase, pe.Err)
+}
+
+func (pe *PhaseError) Unwrap() error {
+	return pe.Err
+}
+
+func NewPhaseError(phase string, err error) *PhaseError {
+	return &PhaseError{Phase: phase, Err: err}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package migrator
+
+import (
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer-sdk-migrator/util"
+)
+
+// PackageStatus describes what happens to a Packer core package when the
+// plugin is migrated.
+type PackageStatus int
+
+const (
+	// PackageMapped packages moved to a single SDK package.
+	PackageMapped PackageStatus = iota
+	// PackageSplit packages were split across several SDK packages.
+	PackageSplit
+	// PackageRemoved packages have no SDK equivalent.
+	PackageRemoved
+)
+
+func (s PackageStatus) String() string {
+	switch s {
+	case PackageMapped:
+		return "moved to SDK (mapped)"
+	case PackageSplit:
+		return "split across SDK packages"
+	case PackageRemoved:
+		return "no SDK equivalent"
+	}
+	return "unknown"
+}
+
+// CorePackage is a Packer core package imported by the plugin, classified
+// using the same rules migrate uses, together with the files importing it
+// and the positions of the import paths in those files.
+type CorePackage struct {
+	ImportPath string
+	Status     PackageStatus
+	// Targets are the SDK packages the package maps to, if any.
+	Targets   []string
+	Files     []string
+	Positions []*token.Position
+}
+
+// CheckSDKPackageImports classifies every Packer core package imported by
+// the plugin, sorted by import path.
+func CheckSDKPackageImports(details *pluginImportDetails, rules *util.Rules) ([]*CorePackage, error) {
+	corePackages := []*CorePackage{}
+
+	for importPath := range details.AllImportPathsHash {
+		if !strings.HasPrefix(importPath, PackerModPath+"/") {
+			continue
+		}
+
+		pkg := classifyPackage(importPath, rules)
+		files, positions, err := filesImporting(details, importPath)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Files = files
+		pkg.Positions = positions
+		corePackages = append(corePackages, pkg)
+	}
+	sort.Slice(corePackages, func(i, j int) bool {
+		return corePackages[i].ImportPath < corePackages[j].ImportPath
+	})
+
+	return corePackages, nil
+}
+
+func classifyPackage(importPath string, rules *util.Rules) *CorePackage {
+	pkg := &CorePackage{ImportPath: importPath, Status: PackageRemoved}
+
+	if to, ok := rules.OneToOne[importPath]; ok {
+		pkg.Status = PackageMapped
+		pkg.Targets = []string{to}
+	} else if to, ok := rules.Rename[importPath]; ok {
+		pkg.Status = PackageMapped
+		pkg.Targets = []string{to}
+	} else if split, ok := rules.Split[importPath]; ok {
+		pkg.Status = PackageSplit
+		for to := range split {
+			pkg.Targets = append(pkg.Targets, to)
+		}
+		sort.Strings(pkg.Targets)
+	}
+
+	return pkg
+}
+
+// removedPackages returns the packages with no SDK equivalent.
+func removedPackages(corePackages []*CorePackage) []*CorePackage {
+	removed := []*CorePackage{}
+	for _, pkg := range corePackages {
+		if pkg.Status == PackageRemoved {
+			removed = append(removed, pkg)
+		}
+	}
+	return removed
+}
+
+// filesImporting returns the files which import importPath, and the position
+// of the import path in each of them. Unlike filesWhichImport, which returns
+// every file of a package importing it, the imports of each file are parsed
+// to only return the files actually importing the package.
+func filesImporting(details *pluginImportDetails, importPath string) ([]string, []*token.Position, error) {
+	candidates, err := filesWhichImport(details, importPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(candidates)
+
+	files := []string{}
+	positions := []*token.Position{}
+	fset := token.NewFileSet()
+	for _, filePath := range candidates {
+		f, err := parser.ParseFile(fset, filePath, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, imp := range f.Imports {
+			if p, err := strconv.Unquote(imp.Path.Value); err == nil && p == importPath {
+				position := fset.Position(imp.Path.Pos())
+				files = append(files, filePath)
+				positions = append(positions, &position)
+				break
+			}
+		}
+	}
+
+	return files, positions, nil
+}
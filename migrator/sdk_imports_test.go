@@ -0,0 +1,102 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package migrator
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/packer-sdk-migrator/util"
+)
+
+func Test_classifyPackage(t *testing.T) {
+	rules, err := util.DefaultRules().ForVersion(util.DefaultSDKVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		importPath string
+		status     PackageStatus
+		targets    []string
+	}{
+		{
+			"github.com/hashicorp/packer/packer",
+			PackageMapped,
+			[]string{"github.com/hashicorp/packer-plugin-sdk/packer"},
+		},
+		{
+			"github.com/hashicorp/packer/provisioner",
+			PackageMapped,
+			[]string{"github.com/hashicorp/packer-plugin-sdk/guestexec"},
+		},
+		{
+			"github.com/hashicorp/packer/hcl2template",
+			PackageSplit,
+			[]string{
+				"github.com/hashicorp/packer-plugin-sdk/hcl2helper",
+				"github.com/hashicorp/packer-plugin-sdk/template/config",
+			},
+		},
+		{
+			"github.com/hashicorp/packer/version",
+			PackageRemoved,
+			nil,
+		},
+	}
+
+	for _, tc := range tests {
+		pkg := classifyPackage(tc.importPath, rules)
+		if pkg.Status != tc.status {
+			t.Errorf("%s: expected status %q, got %q", tc.importPath, tc.status, pkg.Status)
+		}
+		if diff := cmp.Diff(tc.targets, pkg.Targets); diff != "" {
+			t.Errorf("%s: unexpected targets: %s", tc.importPath, diff)
+		}
+	}
+}
+
+func Test_CheckSDKPackageImports_testFiles(t *testing.T) {
+	dir := testPlugin(t, map[string]string{
+		"go.mod":  "module example.com/plugin\n\ngo 1.16\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+		"main_test.go": `package main
+
+import _ "github.com/hashicorp/packer/helper/builder/testing"
+`,
+		"plugin_test.go": `package main_test
+
+import _ "github.com/hashicorp/packer/version"
+`,
+	})
+
+	details, err := GoListPackageImports(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("GoListPackageImports: %s", err)
+	}
+	rules, err := util.DefaultRules().ForVersion(util.DefaultSDKVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corePackages, err := CheckSDKPackageImports(details, rules)
+	if err != nil {
+		t.Fatalf("CheckSDKPackageImports: %s", err)
+	}
+
+	files := map[string][]string{}
+	for _, pkg := range corePackages {
+		for _, f := range pkg.Files {
+			files[pkg.ImportPath] = append(files[pkg.ImportPath], filepath.Base(f))
+		}
+	}
+	expected := map[string][]string{
+		"github.com/hashicorp/packer/helper/builder/testing": {"main_test.go"},
+		"github.com/hashicorp/packer/version":                {"plugin_test.go"},
+	}
+	if diff := cmp.Diff(expected, files); diff != "" {
+		t.Fatalf("unexpected core packages: %s", diff)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package migrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/hashicorp/packer-sdk-migrator/util"
+	goList "github.com/kmoe/go-list"
+	refsParser "github.com/radeksimko/go-refs/parser"
+)
+
+// Offence lists the references to a deprecated identifier in the plugin.
+type Offence struct {
+	IdentDeprecation *IdentDeprecation
+	Positions        []*token.Position
+}
+
+// IdentDeprecation is an identifier of a Packer core package which has no
+// direct equivalent in the SDK.
+type IdentDeprecation struct {
+	ImportPath  string
+	Identifier  *ast.Ident
+	Message     string
+	Replacement string
+}
+
+// deprecations returns the catalogue of deprecated identifiers from the
+// migration rules.
+func deprecations(rules *util.Rules) []*IdentDeprecation {
+	deprecations := []*IdentDeprecation{}
+	for _, d := range rules.Deprecations() {
+		deprecations = append(deprecations, &IdentDeprecation{
+			ImportPath:  d.ImportPath,
+			Identifier:  ast.NewIdent(d.Identifier),
+			Message:     d.Message,
+			Replacement: d.Replacement,
+		})
+	}
+	return deprecations
+}
+
+// pluginImports is a data structure we parse the `go list` output into
+// for efficient searching
+type pluginImportDetails struct {
+	AllImportPathsHash map[string]bool
+	Packages           map[string]pluginPackage
+}
+
+type pluginPackage struct {
+	Dir          string
+	ImportPath   string
+	GoFiles      []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+}
+
+func GoListPackageImports(ctx context.Context, pluginPath string) (*pluginImportDetails, error) {
+	// Only use the vendor directory if there is one, otherwise go list fails
+	// for plugins which don't vendor their dependencies.
+	var args []string
+	hasVendor, err := util.HasVendorFolder(pluginPath)
+	if err != nil {
+		return nil, err
+	}
+	if hasVendor {
+		args = append(args, "-mod=vendor")
+	}
+
+	packages, err := goListPackages(ctx, pluginPath, "./...", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	allImportPathsHash := make(map[string]bool)
+	pluginPackages := make(map[string]pluginPackage)
+
+	for _, p := range packages {
+		// Test files are rewritten by the migration too, so the packages
+		// they import count as much as those of the package itself.
+		for _, imports := range [][]string{p.Imports, p.TestImports, p.XTestImports} {
+			for _, i := range imports {
+				allImportPathsHash[i] = true
+			}
+		}
+
+		pluginPackages[p.ImportPath] = pluginPackage{
+			Dir:          p.Dir,
+			ImportPath:   p.ImportPath,
+			GoFiles:      p.GoFiles,
+			TestGoFiles:  p.TestGoFiles,
+			XTestGoFiles: p.XTestGoFiles,
+			Imports:      p.Imports,
+			TestImports:  p.TestImports,
+			XTestImports: p.XTestImports,
+		}
+	}
+
+	return &pluginImportDetails{
+		AllImportPathsHash: allImportPathsHash,
+		Packages:           pluginPackages,
+	}, nil
+}
+
+// goListPackages runs `go list -json` in workDir, like goList.GoList, but the
+// command is killed if ctx is done, in which case the error of ctx is
+// returned.
+func goListPackages(ctx context.Context, workDir string, path string, args ...string) ([]goList.Package, error) {
+	cmdArgs := append([]string{"list", "-json"}, args...)
+	cmdArgs = append(cmdArgs, path)
+	cmd := exec.CommandContext(ctx, "go", cmdArgs...)
+	cmd.Env = os.Environ()
+	cmd.Dir = workDir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Printf("[DEBUG] Executing command go %q", cmdArgs)
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, util.NewExecError(err, stderr.String())
+	}
+
+	packages := []goList.Package{}
+	dec := json.NewDecoder(&stdout)
+	for {
+		var p goList.Package
+		if err := dec.Decode(&p); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+	return packages, nil
+}
+
+func CheckSDKPackageRefs(pluginImportDetails *pluginImportDetails, rules *util.Rules) ([]*Offence, error) {
+	offences := make([]*Offence, 0, 0)
+
+	for _, d := range deprecations(rules) {
+		fset := token.NewFileSet()
+		files, err := filesWhichImport(pluginImportDetails, d.ImportPath)
+		if err != nil {
+			return nil, err
+		}
+
+		foundPositions := make([]*token.Position, 0, 0)
+
+		for _, filePath := range files {
+			f, err := parser.ParseFile(fset, filePath, nil, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			identifiers, err := refsParser.FindPackageReferences(f, d.ImportPath)
+			if err != nil {
+				// package not imported in this file
+				continue
+			}
+
+			positions, err := findIdentifierPositions(fset, identifiers, d.Identifier)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(positions) > 0 {
+				foundPositions = append(foundPositions, positions...)
+			}
+		}
+
+		if len(foundPositions) > 0 {
+			offences = append(offences, &Offence{
+				IdentDeprecation: d,
+				Positions:        foundPositions,
+			})
+		}
+	}
+
+	return offences, nil
+}
+
+func findIdentifierPositions(fset *token.FileSet, nodes []ast.Node, ident *ast.Ident) ([]*token.Position, error) {
+	positions := make([]*token.Position, 0, 0)
+
+	for _, node := range nodes {
+		nodeName := fmt.Sprint(node)
+		if nodeName == ident.String() {
+			position := fset.Position(node.Pos())
+			positions = append(positions, &position)
+		}
+	}
+
+	return positions, nil
+}
+
+func filesWhichImport(pluginImportDetails *pluginImportDetails, importPath string) (files []string, e error) {
+	files = []string{}
+	for _, p := range pluginImportDetails.Packages {
+		if util.StringSliceContains(p.Imports, importPath) {
+			files = append(files, prependDirToFilePaths(p.GoFiles, p.Dir)...)
+		}
+		if util.StringSliceContains(p.TestImports, importPath) {
+			files = append(files, prependDirToFilePaths(p.TestGoFiles, p.Dir)...)
+		}
+		if util.StringSliceContains(p.XTestImports, importPath) {
+			files = append(files, prependDirToFilePaths(p.XTestGoFiles, p.Dir)...)
+		}
+	}
+
+	return files, nil
+}
+
+func prependDirToFilePaths(filePaths []string, dir string) []string {
+	newFilePaths := []string{}
+	for _, f := range filePaths {
+		newFilePaths = append(newFilePaths, path.Join(dir, f))
+	}
+	return newFilePaths
+}
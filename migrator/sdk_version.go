@@ -1,7 +1,7 @@
 // Copyright (c) HashiCorp, Inc.
 // SPDX-License-Identifier: MPL-2.0
 
-package check
+package migrator
 
 import (
 	"fmt"
@@ -60,3 +60,13 @@ func findMatchingRequireStmt(requires []*modfile.Require, modPath string) (*modu
 
 	return nil, nil
 }
+
+// sameVersion reports whether a and b are the same version.
+func sameVersion(a, b string) bool {
+	va, err := version.NewVersion(a)
+	if err != nil {
+		return a == b
+	}
+	vb, err := version.NewVersion(b)
+	return err == nil && va.Equal(vb)
+}
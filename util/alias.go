@@ -0,0 +1,105 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AliasPolicy decides the names under which rewritten SDK packages are
+// imported.
+type AliasPolicy int
+
+const (
+	// AliasDefault keeps existing import names. Packages imported without a
+	// name are referred to by the last element of their new import path, and
+	// the destinations of a split package imported with a name are imported
+	// as <name>_<package>.
+	AliasDefault AliasPolicy = iota
+	// AliasTable imports the packages listed in the alias rules under their
+	// configured alias, and falls back to AliasDefault for all others.
+	AliasTable
+	// AliasCamelCase derives camelCase names from the default names, e.g.
+	// packercommonCommonsteps rather than packercommon_commonsteps.
+	AliasCamelCase
+)
+
+// AliasPolicies lists the names of all alias policies.
+var AliasPolicies = []string{"default", "table", "camel"}
+
+func (p AliasPolicy) String() string {
+	if int(p) < len(AliasPolicies) {
+		return AliasPolicies[p]
+	}
+	return fmt.Sprintf("AliasPolicy(%d)", int(p))
+}
+
+// ParseAliasPolicy returns the alias policy with the given name.
+func ParseAliasPolicy(name string) (AliasPolicy, error) {
+	for i, p := range AliasPolicies {
+		if p == name {
+			return AliasPolicy(i), nil
+		}
+	}
+	return AliasDefault, fmt.Errorf("unknown alias policy %q, expected one of: %s",
+		name, strings.Join(AliasPolicies, ", "))
+}
+
+// importName applies the policy to the default import name of newImpPath.
+// explicit reports whether the import needs to be named.
+func (p AliasPolicy) importName(aliases map[string]string, newImpPath, name string, explicit bool) (string, bool) {
+	switch p {
+	case AliasTable:
+		if alias, ok := aliases[newImpPath]; ok {
+			return alias, true
+		}
+	case AliasCamelCase:
+		if c := camelCase(name); c != name {
+			return c, true
+		}
+	}
+	return name, explicit
+}
+
+// camelCase drops the underscores from name, upper-casing the letter
+// following each of them.
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	var sb strings.Builder
+	for i, part := range parts {
+		if i == 0 || part == "" {
+			sb.WriteString(part)
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(part)
+		sb.WriteRune(unicode.ToUpper(r))
+		sb.WriteString(part[size:])
+	}
+	if sb.Len() == 0 {
+		return name
+	}
+	return sb.String()
+}
+
+// AliasConflictError is returned when the alias chosen by the alias policy for
+// an import is already declared in the file.
+type AliasConflictError struct {
+	ImportPath string
+	Alias      string
+	// Position is where the conflicting identifier is declared.
+	Position token.Position
+}
+
+func (e *AliasConflictError) Error() string {
+	return fmt.Sprintf("cannot import %s as %s: %s is already declared at %s",
+		e.ImportPath, e.Alias, e.Alias, e.Position)
+}
+
+func NewAliasConflictError(importPath, alias string, pos token.Position) *AliasConflictError {
+	return &AliasConflictError{importPath, alias, pos}
+}
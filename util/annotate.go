@@ -0,0 +1,175 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// AnnotationPrefix starts every comment inserted by the migrator, so the
+// remaining manual work can be found with grep.
+const AnnotationPrefix = "TODO(packer-sdk-migrator): "
+
+const packerModPath = "github.com/hashicorp/packer"
+
+// ImportsOptions controls how the imports of plugin files are rewritten.
+type ImportsOptions struct {
+	// Annotate inserts a TODO comment above each statement the migrator
+	// cannot migrate automatically.
+	Annotate bool
+
+	// AliasPolicy decides the names under which rewritten packages are
+	// imported.
+	AliasPolicy AliasPolicy
+
+	// LocalPrefix, if set, regroups the imports of each rewritten file into
+	// standard library, third-party and local imports, and formats the file
+	// with gofmt. Local imports are those whose path starts with one of the
+	// comma-separated prefixes, as for goimports -local.
+	LocalPrefix string
+}
+
+// annotation is an explanation of manual work, to be inserted as a comment
+// above the statement or declaration containing node. Nodes are kept rather
+// than positions, since sorting imports moves import specs around.
+type annotation struct {
+	node ast.Node
+	text string
+}
+
+// removedPackageNotes returns an annotation for every import of a Packer core
+// package which has no SDK equivalent.
+func removedPackageNotes(f *ast.File, rules *Rules) []*annotation {
+	notes := []*annotation{}
+	for _, impSpec := range f.Imports {
+		impPath, err := strconv.Unquote(impSpec.Path.Value)
+		if err != nil || !strings.HasPrefix(impPath, packerModPath+"/") {
+			continue
+		}
+		if _, ok := rules.OneToOne[impPath]; ok {
+			continue
+		}
+		if _, ok := rules.Rename[impPath]; ok {
+			continue
+		}
+		if _, ok := rules.Split[impPath]; ok {
+			continue
+		}
+		notes = append(notes, &annotation{
+			node: impSpec,
+			text: fmt.Sprintf("%s has no SDK equivalent and must be replaced by hand.", impPath),
+		})
+	}
+	return notes
+}
+
+// deprecationNotes returns an annotation for every reference to a deprecated
+// identifier of an imported package.
+func deprecationNotes(fset *token.FileSet, f *ast.File, rules *Rules, refs *packageRefs) []*annotation {
+	notes := []*annotation{}
+	imports := []string{}
+	for _, impSpec := range f.Imports {
+		impPath, err := strconv.Unquote(impSpec.Path.Value)
+		if err == nil && len(rules.Deprecated[impPath]) > 0 {
+			imports = append(imports, impPath)
+		}
+	}
+	if len(imports) == 0 {
+		return notes
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		for _, impPath := range imports {
+			d, ok := rules.Deprecated[impPath][sel.Sel.Name]
+			if !ok || refs.kind(fset, id, impPath) != refPackage {
+				continue
+			}
+			text := d.Message
+			if d.Replacement != "" {
+				text += fmt.Sprintf(" Suggested replacement: %s", d.Replacement)
+			}
+			notes = append(notes, &annotation{node: id, text: text})
+		}
+		return true
+	})
+	return notes
+}
+
+// annotationEdits returns the edits inserting each annotation as a line
+// comment above the innermost statement, field, spec or declaration
+// containing it, indented like that node. Annotations already present above
+// the node, from an earlier run, are not inserted again.
+func annotationEdits(fset *token.FileSet, f *ast.File, src []byte, notes []*annotation) []*edit {
+	tf := fset.File(f.Pos())
+
+	// existing holds the text of the comments ending on each line.
+	existing := map[int]map[string]bool{}
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			line := tf.Line(c.End())
+			if existing[line] == nil {
+				existing[line] = map[string]bool{}
+			}
+			existing[line][c.Text] = true
+		}
+	}
+
+	edits := []*edit{}
+	seen := map[int]map[string]bool{}
+	for _, note := range notes {
+		line := tf.Line(annotatedNode(f, note.node.Pos()).Pos())
+		text := "// " + AnnotationPrefix + note.text
+
+		if seen[line] == nil {
+			seen[line] = map[string]bool{}
+		}
+		if seen[line][text] || alreadyAnnotated(existing, line, text) {
+			continue
+		}
+		seen[line][text] = true
+
+		start := tf.Offset(tf.LineStart(line))
+		edits = append(edits, &edit{start, start, indentation(src, start) + text + "\n"})
+	}
+	return edits
+}
+
+// alreadyAnnotated reports whether the comment text is part of the block of
+// comment lines directly above line.
+func alreadyAnnotated(existing map[int]map[string]bool, line int, text string) bool {
+	for l := line - 1; existing[l] != nil; l-- {
+		if existing[l][text] {
+			return true
+		}
+	}
+	return false
+}
+
+// annotatedNode returns the node an annotation at pos is inserted above.
+func annotatedNode(f *ast.File, pos token.Pos) ast.Node {
+	path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+	for _, n := range path {
+		switch n.(type) {
+		case *ast.BlockStmt:
+			continue
+		case ast.Stmt, *ast.Field, ast.Spec, ast.Decl:
+			return n
+		}
+	}
+	return f
+}
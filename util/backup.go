@@ -0,0 +1,277 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// StateDir is the directory inside the plugin where the migrator keeps
+	// its own files. It is skipped when rewriting imports, and ignored by
+	// git, see createStateDir.
+	StateDir = ".packer-sdk-migrator"
+
+	backupsDir       = "backups"
+	backupFilesDir   = "files"
+	manifestFilename = "manifest.json"
+	backupIDFormat   = "20060102T150405Z"
+)
+
+// BackupManifest describes a snapshot of plugin files taken before they were
+// modified by a migration.
+type BackupManifest struct {
+	ID        string        `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	Files     []*BackupFile `json:"files"`
+}
+
+// BackupFile is a single file recorded in a backup. Path is relative to the
+// plugin directory, and Mode holds the permissions of the file, which are
+// restored with its content. Files that did not exist when the backup was
+// taken are recorded so they can be removed again on restore.
+type BackupFile struct {
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`
+	SHA256  string      `json:"sha256,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+}
+
+// createStateDir creates the state directory of the plugin if needed, with a
+// .gitignore ignoring everything in it, so that backups of the old sources
+// are not committed along with the migrated ones.
+func createStateDir(pluginPath string) error {
+	dir := filepath.Join(pluginPath, StateDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	gitignore := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(gitignore); !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(gitignore, []byte("*\n"), 0644)
+}
+
+// BackupDir returns the directory holding the backup with the given ID.
+func BackupDir(pluginPath, id string) string {
+	return filepath.Join(pluginPath, StateDir, backupsDir, id)
+}
+
+// CreateBackup copies the given files into a new timestamped backup directory
+// inside the plugin and writes a manifest with their checksums.
+func CreateBackup(pluginPath string, paths []string) (*BackupManifest, error) {
+	if err := createStateDir(pluginPath); err != nil {
+		return nil, err
+	}
+	root := filepath.Join(pluginPath, StateDir, backupsDir)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	// Backups taken within the same second get a numeric suffix.
+	now := time.Now().UTC()
+	id := now.Format(backupIDFormat)
+	for i := 1; ; i++ {
+		err := os.Mkdir(filepath.Join(root, id), 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		id = fmt.Sprintf("%s-%d", now.Format(backupIDFormat), i)
+	}
+
+	manifest := &BackupManifest{
+		ID:        id,
+		CreatedAt: now,
+		Files:     []*BackupFile{},
+	}
+	dir := BackupDir(pluginPath, id)
+
+	seen := map[string]bool{}
+	for _, path := range paths {
+		rel, err := filepath.Rel(pluginPath, path)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		if seen[rel] {
+			continue
+		}
+		seen[rel] = true
+
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			manifest.Files = append(manifest.Files, &BackupFile{Path: rel})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		dst := filepath.Join(dir, backupFilesDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(dst, content, 0644); err != nil {
+			return nil, err
+		}
+
+		manifest.Files = append(manifest.Files, &BackupFile{
+			Path:    rel,
+			Existed: true,
+			SHA256:  checksum(content),
+			Mode:    info.Mode().Perm(),
+		})
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, manifestFilename), content, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// ListBackups returns the manifests of all backups of the plugin, oldest
+// first.
+func ListBackups(pluginPath string) ([]*BackupManifest, error) {
+	root := filepath.Join(pluginPath, StateDir, backupsDir)
+	entries, err := ioutil.ReadDir(root)
+	if os.IsNotExist(err) {
+		return []*BackupManifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []*BackupManifest{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		manifest, err := ReadBackupManifest(pluginPath, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return manifests[i].CreatedAt.Before(manifests[j].CreatedAt)
+	})
+
+	return manifests, nil
+}
+
+// ReadBackupManifest reads the manifest of the backup with the given ID.
+func ReadBackupManifest(pluginPath, id string) (*BackupManifest, error) {
+	content, err := ioutil.ReadFile(filepath.Join(BackupDir(pluginPath, id), manifestFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest for backup %s: %s", id, err)
+	}
+
+	return &manifest, nil
+}
+
+// RestoreBackup rolls the plugin files recorded in the backup back to their
+// recorded content. The checksums of all backed up files are verified before
+// anything is written, and the restored files are verified afterwards.
+func RestoreBackup(pluginPath string, manifest *BackupManifest) error {
+	contents := map[string][]byte{}
+	for _, f := range manifest.Files {
+		if !f.Existed {
+			continue
+		}
+		content, err := ReadBackupFile(pluginPath, manifest, f)
+		if err != nil {
+			return err
+		}
+		contents[f.Path] = content
+	}
+
+	for _, f := range manifest.Files {
+		path := filepath.Join(pluginPath, filepath.FromSlash(f.Path))
+		if !f.Existed {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := WriteFileAtomic(path, contents[f.Path], f.perm()); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range manifest.Files {
+		if !f.Existed {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(pluginPath, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		if sum := checksum(content); sum != f.SHA256 {
+			return fmt.Errorf("checksum mismatch after restoring %s: got %s, expected %s",
+				f.Path, sum, f.SHA256)
+		}
+	}
+
+	return nil
+}
+
+// ReadBackupFile returns the backed up content of the file, after verifying
+// its checksum.
+func ReadBackupFile(pluginPath string, manifest *BackupManifest, f *BackupFile) ([]byte, error) {
+	content, err := ioutil.ReadFile(filepath.Join(BackupDir(pluginPath, manifest.ID), backupFilesDir, filepath.FromSlash(f.Path)))
+	if err != nil {
+		return nil, err
+	}
+	if sum := checksum(content); sum != f.SHA256 {
+		return nil, fmt.Errorf("backup %s is corrupted: checksum of %s is %s, expected %s",
+			manifest.ID, f.Path, sum, f.SHA256)
+	}
+	return content, nil
+}
+
+// MatchesContent reports whether content is the backed up content of the
+// file.
+func (f *BackupFile) MatchesContent(content []byte) bool {
+	return f.Existed && checksum(content) == f.SHA256
+}
+
+// perm returns the permissions to restore the file with. Backups taken
+// before permissions were recorded restore files as 0644.
+func (f *BackupFile) perm() os.FileMode {
+	if f.Mode == 0 {
+		return 0644
+	}
+	return f.Mode
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
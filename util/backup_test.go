@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Backup_restore(t *testing.T) {
+	pluginPath := t.TempDir()
+	goMod := filepath.Join(pluginPath, "go.mod")
+	goSum := filepath.Join(pluginPath, "go.sum")
+	mainGo := filepath.Join(pluginPath, "cmd", "main.go")
+
+	mustWrite(t, goMod, "module example.com/plugin\n")
+	mustWrite(t, mainGo, "package main\n")
+	if err := os.Chmod(mainGo, 0600); err != nil {
+		t.Fatalf("Chmod: %s", err)
+	}
+
+	backup, err := CreateBackup(pluginPath, []string{goMod, goSum, mainGo})
+	if err != nil {
+		t.Fatalf("CreateBackup: %s", err)
+	}
+	gitignore := filepath.Join(pluginPath, StateDir, ".gitignore")
+	if got := string(mustBytes(ioutil.ReadFile(gitignore))); got != "*\n" {
+		t.Fatalf("unexpected .gitignore of the state directory: %q", got)
+	}
+
+	mustWrite(t, goMod, "module example.com/migrated\n")
+	mustWrite(t, goSum, "created by go mod tidy\n")
+	mustWrite(t, mainGo, "package migrated\n")
+
+	backups, err := ListBackups(pluginPath)
+	if err != nil {
+		t.Fatalf("ListBackups: %s", err)
+	}
+	if len(backups) != 1 || backups[0].ID != backup.ID {
+		t.Fatalf("unexpected backups: %#v", backups)
+	}
+
+	if err := RestoreBackup(pluginPath, backups[0]); err != nil {
+		t.Fatalf("RestoreBackup: %s", err)
+	}
+
+	if got := string(mustBytes(ioutil.ReadFile(goMod))); got != "module example.com/plugin\n" {
+		t.Fatalf("unexpected go.mod after restore: %q", got)
+	}
+	if got := string(mustBytes(ioutil.ReadFile(mainGo))); got != "package main\n" {
+		t.Fatalf("unexpected main.go after restore: %q", got)
+	}
+	info, err := os.Stat(mainGo)
+	if err != nil {
+		t.Fatalf("Stat: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected main.go to be restored with mode 0600, got %s", info.Mode())
+	}
+	if _, err := os.Stat(goSum); !os.IsNotExist(err) {
+		t.Fatalf("expected go.sum to be removed, got %v", err)
+	}
+}
+
+func Test_Backup_corrupted(t *testing.T) {
+	pluginPath := t.TempDir()
+	goMod := filepath.Join(pluginPath, "go.mod")
+	mustWrite(t, goMod, "module example.com/plugin\n")
+
+	backup, err := CreateBackup(pluginPath, []string{goMod})
+	if err != nil {
+		t.Fatalf("CreateBackup: %s", err)
+	}
+
+	mustWrite(t, goMod, "module example.com/migrated\n")
+	mustWrite(t, filepath.Join(BackupDir(pluginPath, backup.ID), backupFilesDir, "go.mod"), "tampered\n")
+
+	err = RestoreBackup(pluginPath, backup)
+	if err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Fatalf("expected corrupted backup error, got %v", err)
+	}
+	if got := string(mustBytes(ioutil.ReadFile(goMod))); got != "module example.com/migrated\n" {
+		t.Fatalf("expected go.mod to be left untouched, got %q", got)
+	}
+}
+
+func mustWrite(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("MkdirAll: %s", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// FileChange holds the original and rewritten content of a single file, so
+// changes can be inspected before anything is written to disk.
+type FileChange struct {
+	Path     string
+	Original []byte
+	Updated  []byte
+
+	// Skipped lists references the rewriter left untouched because it could
+	// not rewrite them safely.
+	Skipped []*SkippedReference
+	// Annotations is the number of TODO comments inserted into the file.
+	Annotations int
+	// Aliases lists the imports renamed to avoid conflicting names.
+	Aliases []*AliasDecision
+	// Rewrites lists the lines of the updated file referring to a package
+	// introduced by a mapping rule, ordered by line.
+	Rewrites []*Rewrite
+}
+
+// Rewrite is a line of a rewritten file referring to a package introduced by
+// a mapping rule.
+type Rewrite struct {
+	Line int `json:"line"`
+	// From and To are the import paths mapped by the rule.
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (r *Rewrite) String() string {
+	return fmt.Sprintf("%s -> %s", r.From, r.To)
+}
+
+// RewritesAt returns the rewrites of the given line of the updated file.
+func (fc *FileChange) RewritesAt(line int) []*Rewrite {
+	rewrites := []*Rewrite{}
+	for _, r := range fc.Rewrites {
+		if r.Line == line {
+			rewrites = append(rewrites, r)
+		}
+	}
+	return rewrites
+}
+
+// SkippedReference is a reference to a migrated package that was not
+// rewritten and needs to be looked at by hand.
+type SkippedReference struct {
+	Position token.Position
+	// Expr is the selector expression as written, e.g. "common.StepDownload".
+	Expr   string
+	Reason string
+}
+
+func (sr *SkippedReference) String() string {
+	return fmt.Sprintf("%s: %s: %s", sr.Position, sr.Expr, sr.Reason)
+}
+
+// Changed reports whether the rewritten content differs from the original.
+func (fc *FileChange) Changed() bool {
+	return !bytes.Equal(fc.Original, fc.Updated)
+}
+
+// Write atomically overwrites the file with its rewritten content, keeping
+// its permissions.
+func (fc *FileChange) Write() error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(fc.Path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return WriteFileAtomic(fc.Path, fc.Updated, perm)
+}
+
+// UnifiedDiff renders the changes as a unified diff with paths relative to
+// baseDir, in the format accepted by `git apply` and `patch -p1`.
+func UnifiedDiff(baseDir string, changes []*FileChange) (string, error) {
+	var sb strings.Builder
+	for _, fc := range changes {
+		if !fc.Changed() {
+			continue
+		}
+
+		name, err := filepath.Rel(baseDir, fc.Path)
+		if err != nil {
+			return "", err
+		}
+		name = filepath.ToSlash(name)
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(fc.Original)),
+			B:        difflib.SplitLines(string(fc.Updated)),
+			FromFile: "a/" + name,
+			ToFile:   "b/" + name,
+			Context:  3,
+		})
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(diff)
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_UnifiedDiff(t *testing.T) {
+	base := filepath.FromSlash("/plugin")
+	changes := []*FileChange{
+		{
+			Path:     filepath.Join(base, "go.mod"),
+			Original: []byte("module example.com/plugin\n\nrequire github.com/hashicorp/packer v1.6.5\n"),
+			Updated:  []byte("module example.com/plugin\n\nrequire github.com/hashicorp/packer-plugin-sdk v0.0.14\n"),
+		},
+		{
+			Path:     filepath.Join(base, "unchanged.go"),
+			Original: []byte("package main\n"),
+			Updated:  []byte("package main\n"),
+		},
+	}
+
+	expected := `--- a/go.mod
++++ b/go.mod
+@@ -1,4 +1,4 @@
+ module example.com/plugin
+ 
+-require github.com/hashicorp/packer v1.6.5
++require github.com/hashicorp/packer-plugin-sdk v0.0.14
+ 
+`
+	actual, err := UnifiedDiff(base, changes)
+	if err != nil {
+		t.Fatalf("UnifiedDiff: %s", err)
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("unexpected diff: %s", diff)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// AliasDecision records an import which was given another name than the
+// default one, because the default name was already taken in the file.
+type AliasDecision struct {
+	// Position is the position of the import being rewritten.
+	Position   token.Position
+	ImportPath string
+	// Name is the name the import would have had.
+	Name  string
+	Alias string
+	// Conflict describes what the default name conflicts with.
+	Conflict string
+}
+
+func (ad *AliasDecision) String() string {
+	return fmt.Sprintf("%s: imported %s as %s, since %s", ad.Position, ad.ImportPath, ad.Alias, ad.Conflict)
+}
+
+// newImport is a package import introduced by the rewrite.
+type newImport struct {
+	path     string
+	name     string
+	explicit bool
+	// configured is set if the name was configured by the alias policy, in
+	// which case it is never changed.
+	configured bool
+	// spec is the import spec rewritten in place, or nil if the import has
+	// to be added to the file.
+	spec *ast.ImportSpec
+	// replaced is the import spec of the Packer core package this import
+	// replaces.
+	replaced *ast.ImportSpec
+	// uses are the identifiers referring to the import.
+	uses []*ast.Ident
+	// reused is set if the file imports the package already, under name.
+	reused bool
+}
+
+// resolveCollisions settles the names of the new imports, in order. A name is
+// replaced by an alias if it is taken by another import of the file, is
+// declared at package level, or is declared in a local scope containing one
+// of its uses. taken maps the names of the imports left untouched to their
+// import path.
+func resolveCollisions(fset *token.FileSet, refs *packageRefs, imports []*newImport, taken map[string]string, policy AliasPolicy) []*AliasDecision {
+	decisions := []*AliasDecision{}
+	for _, imp := range imports {
+		// Dot and blank imports do not declare a name, and reused imports
+		// keep theirs.
+		if imp.name == "." || imp.name == "_" || imp.reused {
+			continue
+		}
+		uses := make([]int, len(imp.uses))
+		for i, id := range imp.uses {
+			uses[i] = fset.PositionFor(id.Pos(), false).Offset
+		}
+		conflict := func(name string) string {
+			if path, ok := taken[name]; ok {
+				return fmt.Sprintf("%s is already the name of the import of %s", name, path)
+			}
+			if pos, ok := refs.conflict(name, uses); ok {
+				return fmt.Sprintf("%s is declared at %s", name, pos)
+			}
+			return ""
+		}
+
+		if c := conflict(imp.name); c != "" && !imp.configured {
+			alias := aliasCandidate(imp.name, policy, 1)
+			for i := 2; conflict(alias) != ""; i++ {
+				alias = aliasCandidate(imp.name, policy, i)
+			}
+			decisions = append(decisions, &AliasDecision{
+				Position:   fset.Position(imp.replaced.Pos()),
+				ImportPath: imp.path,
+				Name:       imp.name,
+				Alias:      alias,
+				Conflict:   c,
+			})
+			imp.name = alias
+			imp.explicit = true
+		}
+		taken[imp.name] = imp.path
+	}
+	return decisions
+}
+
+// aliasCandidate returns the n-th alternative name for an import named name,
+// starting at 1.
+func aliasCandidate(name string, policy AliasPolicy, n int) string {
+	alias := "sdk" + name
+	if policy == AliasCamelCase {
+		alias = camelCase("sdk_" + name)
+	}
+	if n > 1 {
+		alias += strconv.Itoa(n)
+	}
+	return alias
+}
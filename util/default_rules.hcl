@@ -0,0 +1,321 @@
+# Copyright (c) HashiCorp, Inc.
+# SPDX-License-Identifier: MPL-2.0
+
+# Built-in mapping rules used to migrate plugins from the Packer core module to
+# the packer-plugin-sdk module. A rules file passed with --rules uses the same
+# format and is applied on top of these rules: any package listed there
+# replaces the built-in rule for the same package.
+#
+# Rules at the top level apply to every SDK version. Rules inside an sdk block
+# only apply when migrating to an SDK version matching its constraint, and at
+# least one sdk block must match the requested version. Packs are listed
+# oldest first.
+
+# The easiest replacements are those where we simply moved a package from the
+# Packer core without changing the package name. All we have to do for these
+# packages is change the imports and they'll work automagically.
+move "github.com/hashicorp/packer/common/adapter" {
+  to = "github.com/hashicorp/packer-plugin-sdk/adapter"
+}
+move "github.com/hashicorp/packer/common/bootcommand" {
+  to = "github.com/hashicorp/packer-plugin-sdk/bootcommand"
+}
+move "github.com/hashicorp/packer/common/chroot" {
+  to = "github.com/hashicorp/packer-plugin-sdk/chroot"
+}
+move "github.com/hashicorp/packer/helper/communicator" {
+  to = "github.com/hashicorp/packer-plugin-sdk/communicator"
+}
+move "github.com/hashicorp/packer/helper/config" {
+  to = "github.com/hashicorp/packer-plugin-sdk/template/config"
+}
+move "github.com/hashicorp/packer/template/interpolate" {
+  to = "github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+}
+move "github.com/hashicorp/packer/helper/multistep" {
+  to = "github.com/hashicorp/packer-plugin-sdk/multistep"
+}
+move "github.com/hashicorp/packer/common/net" {
+  to = "github.com/hashicorp/packer-plugin-sdk/net"
+}
+move "github.com/hashicorp/packer/packer" {
+  to = "github.com/hashicorp/packer-plugin-sdk/packer"
+}
+move "github.com/hashicorp/packer/packer/plugin" {
+  to = "github.com/hashicorp/packer-plugin-sdk/plugin"
+}
+move "github.com/hashicorp/packer/common/retry" {
+  to = "github.com/hashicorp/packer-plugin-sdk/retry"
+}
+move "github.com/hashicorp/packer/packer/rpc" {
+  to = "github.com/hashicorp/packer-plugin-sdk/rpc"
+}
+move "github.com/hashicorp/packer/template/interpolate/aws/secretsmanager" {
+  to = "github.com/hashicorp/packer-plugin-sdk/template/interpolate/aws/secretsmanager"
+}
+move "github.com/hashicorp/packer/common/shell" {
+  to = "github.com/hashicorp/packer-plugin-sdk/shell"
+}
+move "github.com/hashicorp/packer/common/shell-local" {
+  to = "github.com/hashicorp/packer-plugin-sdk/shell-local/config.go"
+}
+move "github.com/hashicorp/packer/common/shutdowncommand" {
+  to = "github.com/hashicorp/packer-plugin-sdk/shutdowncommand"
+}
+move "github.com/hashicorp/packer/helper/ssh" {
+  to = "github.com/hashicorp/packer-plugin-sdk/communicator/ssh"
+}
+move "github.com/hashicorp/packer/helper/communicator/sshkey" {
+  to = "github.com/hashicorp/packer-plugin-sdk/communicator/sshkey"
+}
+move "github.com/hashicorp/packer/template" {
+  to = "github.com/hashicorp/packer-plugin-sdk/template"
+}
+move "github.com/hashicorp/packer/communicator/winrm" {
+  to = "github.com/hashicorp/packer-plugin-sdk/sdk-internals/communicator/winrm"
+}
+move "github.com/hashicorp/packer/common/uuid" {
+  to = "github.com/hashicorp/packer-plugin-sdk/uuid"
+}
+
+# Some packages were moved all as one, but the module name was changed so we
+# need to not only change the import path but also how the module is
+# referenced in expressions within the file.
+rename "github.com/hashicorp/packer/provisioner" {
+  to = "github.com/hashicorp/packer-plugin-sdk/guestexec"
+}
+rename "github.com/hashicorp/packer/builder" {
+  to = "github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
+}
+rename "github.com/hashicorp/packer/helper/builder/testing" {
+  to = "github.com/hashicorp/packer-plugin-sdk/acctest"
+}
+
+# For packages that got split up into multiple destination packages, we have
+# to list which exported identifiers ended up where in order to properly fix
+# the file.
+split "github.com/hashicorp/packer/common" {
+  into "github.com/hashicorp/packer-plugin-sdk/common" {
+    identifiers = [
+      "BuildNameConfigKey",
+      "BuilderTypeConfigKey",
+      "CoreVersionConfigKey",
+      "DebugConfigKey",
+      "ForceConfigKey",
+      "OnErrorConfigKey",
+      "TemplatePathKey",
+      "UserVariablesConfigKey",
+      "PackerConfig",
+      "CommandWrapper",
+      "ShellCommand",
+    ]
+  }
+  into "github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps" {
+    identifiers = [
+      "CDConfig",
+      "FloppyConfig",
+      "HTTPConfig",
+      "ISOConfig",
+      "StepCleanupTempKeys",
+      "StepCreateCD",
+      "StepCreateFloppy",
+      "StepDownload",
+      "StepHTTPServer",
+      "StepOutputDir",
+      "StepProvision",
+      "MultistepDebugFn",
+      "NewRunner",
+      "NewRunnerWithPauseFn",
+      "PopulateProvisionHookData",
+    ]
+  }
+}
+
+# Names SDK packages are imported as when migrating with --alias-policy=table.
+# The SDK packer package is commonly imported as packersdk, which keeps it apart
+# from the Packer core packer package in plugins depending on both.
+alias "github.com/hashicorp/packer-plugin-sdk/packer" {
+  name = "packersdk"
+}
+
+# Identifiers of mapped packages which did not make it into the SDK, or ended
+# up in a different package. They are reported by the check command together
+# with a suggested replacement, and must be fixed by hand before migrating.
+deprecated "github.com/hashicorp/packer/common" "Retry" {
+  message     = "common.Retry was removed. Use the retry package of the SDK, which takes a context and supports backoff."
+  replacement = "retry.Config{Tries: numTries}.Run(ctx, fn)"
+}
+deprecated "github.com/hashicorp/packer/common" "RetryableFunc" {
+  message     = "common.RetryableFunc was removed along with common.Retry. retry.Config.Run takes a function with a context."
+  replacement = "func(ctx context.Context) error"
+}
+deprecated "github.com/hashicorp/packer/common" "RetryExhaustedError" {
+  message     = "common.RetryExhaustedError moved to the retry package of the SDK."
+  replacement = "retry.RetryExhaustedError"
+}
+deprecated "github.com/hashicorp/packer/common" "PackerKeyEnv" {
+  message     = "common.PackerKeyEnv moved to the bootcommand package of the SDK."
+  replacement = "bootcommand.PackerKeyEnv"
+}
+deprecated "github.com/hashicorp/packer/common" "PackerKeyDefault" {
+  message     = "common.PackerKeyDefault moved to the bootcommand package of the SDK."
+  replacement = "bootcommand.PackerKeyDefault"
+}
+deprecated "github.com/hashicorp/packer/common" "GetTerminalDimensions" {
+  message     = "common.GetTerminalDimensions was removed. Query the terminal with golang.org/x/term instead."
+  replacement = "term.GetSize(int(os.Stdout.Fd()))"
+}
+
+deprecated "github.com/hashicorp/packer/packer" "ConfigDir" {
+  message     = "packer.ConfigDir moved to the pathing package of the SDK."
+  replacement = "pathing.ConfigDir()"
+}
+deprecated "github.com/hashicorp/packer/packer" "ConfigFile" {
+  message     = "packer.ConfigFile moved to the pathing package of the SDK."
+  replacement = "pathing.ConfigFile()"
+}
+deprecated "github.com/hashicorp/packer/packer" "ExpandUser" {
+  message     = "packer.ExpandUser moved to the pathing package of the SDK."
+  replacement = "pathing.ExpandUser(path)"
+}
+deprecated "github.com/hashicorp/packer/packer" "BuildNameConfigKey" {
+  message     = "packer.BuildNameConfigKey moved to the common package of the SDK."
+  replacement = "common.BuildNameConfigKey"
+}
+deprecated "github.com/hashicorp/packer/packer" "BuilderTypeConfigKey" {
+  message     = "packer.BuilderTypeConfigKey moved to the common package of the SDK."
+  replacement = "common.BuilderTypeConfigKey"
+}
+deprecated "github.com/hashicorp/packer/packer" "DebugConfigKey" {
+  message     = "packer.DebugConfigKey moved to the common package of the SDK."
+  replacement = "common.DebugConfigKey"
+}
+deprecated "github.com/hashicorp/packer/packer" "ForceConfigKey" {
+  message     = "packer.ForceConfigKey moved to the common package of the SDK."
+  replacement = "common.ForceConfigKey"
+}
+deprecated "github.com/hashicorp/packer/packer" "OnErrorConfigKey" {
+  message     = "packer.OnErrorConfigKey moved to the common package of the SDK."
+  replacement = "common.OnErrorConfigKey"
+}
+deprecated "github.com/hashicorp/packer/packer" "TemplatePathKey" {
+  message     = "packer.TemplatePathKey moved to the common package of the SDK."
+  replacement = "common.TemplatePathKey"
+}
+deprecated "github.com/hashicorp/packer/packer" "UserVariablesConfigKey" {
+  message     = "packer.UserVariablesConfigKey moved to the common package of the SDK."
+  replacement = "common.UserVariablesConfigKey"
+}
+deprecated "github.com/hashicorp/packer/packer" "BasicPlaceholderData" {
+  message     = "packer.BasicPlaceholderData was removed: provisioner placeholder data is generated by Packer core. Builders share generated data with packerbuilderdata.GeneratedData."
+}
+deprecated "github.com/hashicorp/packer/packer" "BuilderDataCommonKeys" {
+  message = "packer.BuilderDataCommonKeys was removed: the keys of the data shared by builders are defined by Packer core."
+}
+deprecated "github.com/hashicorp/packer/packer" "CastDataToMap" {
+  message = "packer.CastDataToMap was removed. Convert the generated data to a map[string]interface{} in the plugin."
+}
+deprecated "github.com/hashicorp/packer/packer" "NoopUi" {
+  message     = "packer.NoopUi was removed. Use a BasicUi discarding its output."
+  replacement = "&packer.BasicUi{Reader: os.Stdin, Writer: ioutil.Discard, ErrorWriter: ioutil.Discard}"
+}
+deprecated "github.com/hashicorp/packer/packer" "ColoredUi" {
+  message     = "packer.ColoredUi was removed: the UI of a plugin is provided by Packer core."
+  replacement = "packer.BasicUi"
+}
+deprecated "github.com/hashicorp/packer/packer" "MachineReadableUi" {
+  message     = "packer.MachineReadableUi was removed: the UI of a plugin is provided by Packer core."
+  replacement = "packer.BasicUi"
+}
+deprecated "github.com/hashicorp/packer/packer" "MockPostProcessor" {
+  message = "packer.MockPostProcessor was removed. Implement packer.PostProcessor in the test instead."
+}
+deprecated "github.com/hashicorp/packer/packer" "TestBuilder" {
+  message = "packer.TestBuilder was removed along with the other test helpers of Packer core."
+}
+deprecated "github.com/hashicorp/packer/packer" "TestProvisioner" {
+  message     = "packer.TestProvisioner was removed along with the other test helpers of Packer core."
+  replacement = "&packer.MockProvisioner{}"
+}
+deprecated "github.com/hashicorp/packer/packer" "TestPostProcessor" {
+  message = "packer.TestPostProcessor was removed along with the other test helpers of Packer core."
+}
+
+deprecated "github.com/hashicorp/packer/packer/plugin" "Client" {
+  message     = "plugin.Client was removed: plugin clients are started by Packer core. Plugins serve their components with plugin.Set."
+  replacement = "plugin.NewSet()"
+}
+deprecated "github.com/hashicorp/packer/packer/plugin" "ClientConfig" {
+  message     = "plugin.ClientConfig was removed: plugin clients are started by Packer core. Plugins serve their components with plugin.Set."
+  replacement = "plugin.NewSet()"
+}
+deprecated "github.com/hashicorp/packer/packer/plugin" "NewClient" {
+  message     = "plugin.NewClient was removed: plugin clients are started by Packer core. Plugins serve their components with plugin.Set."
+  replacement = "plugin.NewSet()"
+}
+deprecated "github.com/hashicorp/packer/packer/plugin" "CleanupClients" {
+  message = "plugin.CleanupClients was removed: plugin clients are managed by Packer core."
+}
+deprecated "github.com/hashicorp/packer/packer/plugin" "APIVersion" {
+  message     = "plugin.APIVersion was replaced by a major and a minor protocol version."
+  replacement = "plugin.APIVersionMajor + \".\" + plugin.APIVersionMinor"
+}
+
+deprecated "github.com/hashicorp/packer/helper/builder/testing" "TestBuilderStore" {
+  message = "TestBuilderStore was removed from the acceptance test helpers: builders are looked up by the acctest package itself."
+}
+
+# Packages below differ between SDK releases.
+
+# The hcl2helper package was introduced in v0.0.8; earlier releases only
+# received the config helpers from hcl2template.
+sdk ">= 0.0.6, < 0.0.8" {
+  split "github.com/hashicorp/packer/hcl2template" {
+    into "github.com/hashicorp/packer-plugin-sdk/template/config" {
+      identifiers = [
+        "KeyValue",
+        "KeyValues",
+        "KeyValueFilter",
+        "NameValue",
+        "NameValues",
+        "NameValueFilter",
+        "FlatKeyValue",
+        "FlatKeyValueFilter",
+        "FlatNameValue",
+        "FlatNameValueFilter",
+      ]
+    }
+  }
+}
+
+sdk ">= 0.0.8, < 0.5.0" {
+  split "github.com/hashicorp/packer/hcl2template" {
+    into "github.com/hashicorp/packer-plugin-sdk/hcl2helper" {
+      identifiers = [
+        "NestedMockConfig",
+        "MockTag",
+        "MockConfig",
+        "NamedMapStringString",
+        "NamedString",
+        "FlatMockConfig",
+        "FlatMockTag",
+        "FlatNestedMockConfig",
+        "HCL2ValueFromConfigValue",
+      ]
+    }
+    into "github.com/hashicorp/packer-plugin-sdk/template/config" {
+      identifiers = [
+        "KeyValue",
+        "KeyValues",
+        "KeyValueFilter",
+        "NameValue",
+        "NameValues",
+        "NameValueFilter",
+        "FlatKeyValue",
+        "FlatKeyValueFilter",
+        "FlatNameValue",
+        "FlatNameValueFilter",
+      ]
+    }
+  }
+}
@@ -0,0 +1,72 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// unqualifiedUses returns the destination packages of the split package
+// importPath, imported with a dot import, which are referred to by
+// unqualified identifiers of the file, given the destination of each
+// identifier of the split package. Unqualified identifiers which could not be
+// resolved, nor mapped to any destination, are returned as well: they may be
+// declared in the split package, or in another package imported with a dot
+// import. Identifiers resolved to another package are left out.
+func unqualifiedUses(fset *token.FileSet, f *ast.File, refs *packageRefs, importPath string, destinations map[string]string) ([]string, []*ast.Ident) {
+	// Identifiers which are never references to a package-level identifier.
+	ignored := map[*ast.Ident]bool{f.Name: true}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.SelectorExpr:
+			ignored[n.Sel] = true
+		case *ast.CompositeLit:
+			// Keys of struct literals are field names, which cannot be
+			// told apart from other keys without the type of the literal.
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if id, ok := kv.Key.(*ast.Ident); ok {
+						ignored[id] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	used := map[string]bool{}
+	unmapped := []*ast.Ident{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if _, ok := n.(*ast.ImportSpec); ok {
+			return false
+		}
+		id, ok := n.(*ast.Ident)
+		if !ok || ignored[id] || id.Name == "_" {
+			return true
+		}
+		offset := fset.PositionFor(id.Pos(), false).Offset
+		if p, ok := refs.foreign[offset]; ok && p != importPath {
+			return true
+		} else if !ok && refs.resolved[offset] {
+			return true
+		}
+		if dest, ok := destinations[id.Name]; ok {
+			used[dest] = true
+		} else {
+			unmapped = append(unmapped, id)
+		}
+		return true
+	})
+
+	dests := []string{}
+	for dest := range used {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+	return dests, unmapped
+}
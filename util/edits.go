@@ -0,0 +1,326 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+)
+
+// edit replaces the bytes between the offsets start and end of a file with
+// text. Insertions have start == end.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// applyEdits applies non-overlapping edits to src. Insertions at the same
+// offset are applied in the order they were made, before any replacement
+// starting at that offset. Overlapping edits are an error, since applying
+// them would corrupt the file.
+func applyEdits(src []byte, edits []*edit) ([]byte, error) {
+	sorted := make([]*edit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].start != sorted[j].start {
+			return sorted[i].start < sorted[j].start
+		}
+		return sorted[i].start == sorted[i].end && sorted[j].start != sorted[j].end
+	})
+
+	var out bytes.Buffer
+	last := 0
+	for i, e := range sorted {
+		if e.start < last {
+			prev := sorted[i-1]
+			return nil, fmt.Errorf("overlapping edits at offsets %d-%d and %d-%d", prev.start, prev.end, e.start, e.end)
+		}
+		out.Write(src[last:e.start])
+		out.WriteString(e.text)
+		last = e.end
+	}
+	out.Write(src[last:])
+	return out.Bytes(), nil
+}
+
+// lineStart returns the offset of the start of the line containing offset.
+func lineStart(src []byte, offset int) int {
+	return bytes.LastIndexByte(src[:offset], '\n') + 1
+}
+
+// lineEnd returns the offset just after the newline ending the line
+// containing offset.
+func lineEnd(src []byte, offset int) int {
+	i := bytes.IndexByte(src[offset:], '\n')
+	if i < 0 {
+		return len(src)
+	}
+	return offset + i + 1
+}
+
+// indentation returns the leading whitespace of the line containing offset.
+func indentation(src []byte, offset int) string {
+	start := lineStart(src, offset)
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
+
+// blank reports whether b only holds whitespace.
+func blank(b []byte) bool {
+	return len(bytes.TrimSpace(b)) == 0
+}
+
+// ownsLine reports whether the node spanning the offsets start and end is
+// alone on its lines, apart from a trailing line comment.
+func ownsLine(src []byte, start, end int) bool {
+	if !blank(src[lineStart(src, start):start]) {
+		return false
+	}
+	rest := bytes.TrimSpace(src[end:lineEnd(src, end)])
+	return len(rest) == 0 || bytes.HasPrefix(rest, []byte("//"))
+}
+
+// addedImport is an import added to the file next to the spec it replaces.
+type addedImport struct {
+	name, path string
+	near       *ast.ImportSpec
+}
+
+func (ai *addedImport) String() string {
+	if ai.name == "" {
+		return strconv.Quote(ai.path)
+	}
+	return ai.name + " " + strconv.Quote(ai.path)
+}
+
+// importEdits returns the edits deleting the import specs matching deletes,
+// which maps import paths to import names, and adding the imports in adds to
+// the group of the spec they replace. Only the affected lines change.
+func importEdits(fset *token.FileSet, f *ast.File, src []byte, adds []*addedImport, deletes map[string]string) []*edit {
+	tf := fset.File(f.Pos())
+	off := func(p token.Pos) int { return tf.Offset(p) }
+
+	deleted := map[*ast.ImportSpec]bool{}
+	existing := map[string]bool{}
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if n, ok := deletes[path]; ok && n == name {
+			deleted[spec] = true
+			continue
+		}
+		existing[(&addedImport{name: name, path: path}).String()] = true
+	}
+
+	edits := []*edit{}
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+
+		// Imports are added to the group of the spec they replace, keyed
+		// by the last spec of that group.
+		groupEnd := map[*ast.ImportSpec]*ast.ImportSpec{}
+		var group []*ast.ImportSpec
+		for i, s := range d.Specs {
+			spec := s.(*ast.ImportSpec)
+			group = append(group, spec)
+			if i+1 < len(d.Specs) && tf.Line(specStart(d.Specs[i+1].(*ast.ImportSpec))) <= tf.Line(spec.End())+1 {
+				continue
+			}
+			for _, g := range group {
+				groupEnd[g] = spec
+			}
+			group = nil
+		}
+
+		declAdds := map[*ast.ImportSpec][]*addedImport{}
+		var ordered []*addedImport
+		for _, ai := range adds {
+			last, ok := groupEnd[ai.near]
+			if !ok || existing[ai.String()] {
+				continue
+			}
+			existing[ai.String()] = true
+			declAdds[last] = append(declAdds[last], ai)
+			ordered = append(ordered, ai)
+		}
+
+		remaining := 0
+		for _, s := range d.Specs {
+			if !deleted[s.(*ast.ImportSpec)] {
+				remaining++
+			}
+		}
+
+		start := d.Pos()
+		if d.Doc != nil {
+			start = d.Doc.Pos()
+		}
+
+		if remaining == 0 && len(ordered) == 0 {
+			edits = append(edits, &edit{lineStart(src, off(start)), lineEnd(src, off(d.End())), ""})
+			continue
+		}
+
+		if !d.Lparen.IsValid() {
+			// A single import without parentheses is turned into an
+			// import block if anything is added.
+			if len(ordered) == 0 {
+				continue
+			}
+			spec := d.Specs[0].(*ast.ImportSpec)
+			var sb bytes.Buffer
+			sb.WriteString("import (\n")
+			if !deleted[spec] {
+				specEnd := lineEnd(src, off(spec.End()))
+				sb.WriteString("\t")
+				sb.Write(bytes.TrimSpace(src[off(spec.Pos()):specEnd]))
+				sb.WriteString("\n")
+			}
+			for _, ai := range ordered {
+				sb.WriteString("\t" + ai.String() + "\n")
+			}
+			sb.WriteString(")")
+			edits = append(edits, &edit{off(d.Pos()), lineEnd(src, off(d.End())) - 1, sb.String()})
+			continue
+		}
+
+		// The first import replacing a deleted spec takes its place, so that
+		// the comments of the spec are kept.
+		replacement := map[*ast.ImportSpec]*addedImport{}
+		for _, ai := range ordered {
+			if deleted[ai.near] && replacement[ai.near] == nil {
+				replacement[ai.near] = ai
+			}
+		}
+
+		for _, s := range d.Specs {
+			spec := s.(*ast.ImportSpec)
+			if ai := replacement[spec]; ai != nil {
+				edits = append(edits, &edit{off(spec.Pos()), off(spec.End()), ai.String()})
+			} else if deleted[spec] {
+				start, end := off(specStart(spec)), off(spec.End())
+				if ownsLine(src, start, end) {
+					start, end = lineStart(src, start), lineEnd(src, end)
+				}
+				edits = append(edits, &edit{start, end, ""})
+			}
+			for _, ai := range declAdds[spec] {
+				if replacement[ai.near] == ai {
+					continue
+				}
+				at := lineEnd(src, off(spec.End()))
+				edits = append(edits, &edit{at, at, indentation(src, off(spec.Pos())) + ai.String() + "\n"})
+			}
+		}
+	}
+	return edits
+}
+
+// specStart returns the start of the spec including its doc comment.
+func specStart(spec *ast.ImportSpec) token.Pos {
+	if spec.Doc != nil {
+		return spec.Doc.Pos()
+	}
+	return spec.Pos()
+}
+
+// sortImportGroups sorts the specs of each group of imports containing one of
+// the import paths in touched, the way gofmt does, moving doc comments along
+// with their spec. All other groups are left as they are.
+func sortImportGroups(filename string, src []byte, touched map[string]bool) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	tf := fset.File(f.Pos())
+	off := func(p token.Pos) int { return tf.Offset(p) }
+
+	edits := []*edit{}
+	sortGroup := func(group []*ast.ImportSpec) {
+		if len(group) < 2 {
+			return
+		}
+		isTouched := false
+		for _, spec := range group {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			isTouched = isTouched || touched[path]
+		}
+		if !isTouched {
+			return
+		}
+
+		type unit struct {
+			path, name, text string
+		}
+		units := []*unit{}
+		for _, spec := range group {
+			start, end := off(specStart(spec)), off(spec.End())
+			if !ownsLine(src, start, end) {
+				return
+			}
+			u := &unit{text: string(src[lineStart(src, start):lineEnd(src, end)])}
+			u.path, _ = strconv.Unquote(spec.Path.Value)
+			if spec.Name != nil {
+				u.name = spec.Name.Name
+			}
+			units = append(units, u)
+		}
+		less := func(i, j int) bool {
+			if units[i].path != units[j].path {
+				return units[i].path < units[j].path
+			}
+			return units[i].name < units[j].name
+		}
+		if sort.SliceIsSorted(units, less) {
+			return
+		}
+		sort.SliceStable(units, less)
+
+		var sb bytes.Buffer
+		for _, u := range units {
+			sb.WriteString(u.text)
+		}
+		start := lineStart(src, off(specStart(group[0])))
+		end := lineEnd(src, off(group[len(group)-1].End()))
+		edits = append(edits, &edit{start, end, sb.String()})
+	}
+
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT || !d.Lparen.IsValid() {
+			continue
+		}
+		var group []*ast.ImportSpec
+		for i, s := range d.Specs {
+			spec := s.(*ast.ImportSpec)
+			group = append(group, spec)
+			if i+1 < len(d.Specs) && tf.Line(specStart(d.Specs[i+1].(*ast.ImportSpec))) <= tf.Line(spec.End())+1 {
+				continue
+			}
+			sortGroup(group)
+			group = nil
+		}
+	}
+
+	updated, err := applyEdits(src, edits)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return updated, nil
+}
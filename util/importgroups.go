@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Import groups, in the order goimports lays them out.
+const (
+	stdImports = iota
+	thirdPartyImports
+	localImports
+)
+
+// importGroup returns the group of the import path. localPrefix is a
+// comma-separated list of import path prefixes, as for goimports -local.
+func importGroup(path, localPrefix string) int {
+	for _, prefix := range strings.Split(localPrefix, ",") {
+		if prefix != "" && strings.HasPrefix(path, prefix) {
+			return localImports
+		}
+	}
+	if !strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+		return stdImports
+	}
+	return thirdPartyImports
+}
+
+// groupImports regroups the specs of each import block of the file into
+// standard library, third-party and local imports, separated by blank lines,
+// and formats the file with gofmt. Doc and line comments move along with
+// their spec. Blocks holding other comments, or specs sharing a line, are
+// only formatted.
+func groupImports(filename string, src []byte, localPrefix string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	tf := fset.File(f.Pos())
+	off := func(p token.Pos) int { return tf.Offset(p) }
+
+	edits := []*edit{}
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT || !d.Lparen.IsValid() || len(d.Specs) == 0 {
+			continue
+		}
+
+		groups := make([][]string, localImports+1)
+		owned := map[*ast.CommentGroup]bool{}
+		regroup := true
+		for _, s := range d.Specs {
+			spec := s.(*ast.ImportSpec)
+			start, end := off(specStart(spec)), off(spec.End())
+			if !ownsLine(src, start, end) {
+				regroup = false
+				break
+			}
+			owned[spec.Doc] = true
+			owned[spec.Comment] = true
+
+			path, _ := strconv.Unquote(spec.Path.Value)
+			g := importGroup(path, localPrefix)
+			groups[g] = append(groups[g], string(src[lineStart(src, start):lineEnd(src, end)]))
+		}
+		for _, cg := range f.Comments {
+			if cg.Pos() > d.Lparen && cg.End() < d.Rparen && !owned[cg] {
+				regroup = false
+			}
+		}
+		if !regroup {
+			continue
+		}
+
+		var sb bytes.Buffer
+		for _, group := range groups {
+			if len(group) == 0 {
+				continue
+			}
+			if sb.Len() > 0 {
+				sb.WriteString("\n")
+			}
+			for _, text := range group {
+				sb.WriteString(text)
+			}
+		}
+		start := lineStart(src, off(specStart(d.Specs[0].(*ast.ImportSpec))))
+		end := lineEnd(src, off(d.Specs[len(d.Specs)-1].End()))
+		edits = append(edits, &edit{start, end, sb.String()})
+	}
+
+	updated, err := applyEdits(src, edits)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return format.Source(updated)
+}
@@ -0,0 +1,202 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	journalDir      = "journal"
+	journalFilename = "journal.json"
+	journalFilesDir = "files"
+)
+
+// Journal records the progress of a migration inside the plugin, so that a
+// migration which died halfway can be resumed. It holds the rewritten
+// content of every file the migration writes, and is removed once the
+// migration is complete or rolled back.
+type Journal struct {
+	BackupID   string    `json:"backup_id"`
+	SDKVersion string    `json:"sdk_version"`
+	StartedAt  time.Time `json:"started_at"`
+	// Phases lists the completed phases of the migration, in order.
+	Phases []string       `json:"phases"`
+	Files  []*JournalFile `json:"files"`
+
+	pluginPath string
+}
+
+// JournalFile is a file written by a migration. Path is relative to the
+// plugin directory, and SHA256 is the checksum of its rewritten content.
+// Rewrites are the rewrites of the FileChange, which explain the errors of
+// the migrated plugin once the migration is resumed.
+type JournalFile struct {
+	Path     string     `json:"path"`
+	SHA256   string     `json:"sha256"`
+	Written  bool       `json:"written"`
+	Rewrites []*Rewrite `json:"rewrites,omitempty"`
+}
+
+// JournalDir returns the directory holding the journal of the plugin.
+func JournalDir(pluginPath string) string {
+	return filepath.Join(pluginPath, StateDir, journalDir)
+}
+
+// CreateJournal starts the journal of a migration writing the given changes,
+// after the files were backed up to the backup with the given ID.
+func CreateJournal(pluginPath, backupID, sdkVersion string, changes []*FileChange) (*Journal, error) {
+	if err := RemoveJournal(pluginPath); err != nil {
+		return nil, err
+	}
+	if err := createStateDir(pluginPath); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(JournalDir(pluginPath), 0755); err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		BackupID:   backupID,
+		SDKVersion: sdkVersion,
+		StartedAt:  time.Now().UTC(),
+		Phases:     []string{},
+		Files:      []*JournalFile{},
+		pluginPath: pluginPath,
+	}
+
+	for _, change := range changes {
+		rel, err := filepath.Rel(pluginPath, change.Path)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		dst := filepath.Join(JournalDir(pluginPath), journalFilesDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(dst, change.Updated, 0644); err != nil {
+			return nil, err
+		}
+		j.Files = append(j.Files, &JournalFile{Path: rel, SHA256: checksum(change.Updated), Rewrites: change.Rewrites})
+	}
+
+	return j, j.save()
+}
+
+// ReadJournal reads the journal of the plugin. It returns nil if no
+// migration is in progress.
+func ReadJournal(pluginPath string) (*Journal, error) {
+	content, err := ioutil.ReadFile(filepath.Join(JournalDir(pluginPath), journalFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{pluginPath: pluginPath}
+	if err := json.Unmarshal(content, j); err != nil {
+		return nil, fmt.Errorf("invalid migration journal: %s", err)
+	}
+	return j, nil
+}
+
+// RemoveJournal removes the journal of the plugin, if any.
+func RemoveJournal(pluginPath string) error {
+	return os.RemoveAll(JournalDir(pluginPath))
+}
+
+// Remove removes the journal, once the migration is complete or rolled back.
+func (j *Journal) Remove() error {
+	return RemoveJournal(j.pluginPath)
+}
+
+// Completed reports whether the phase was completed.
+func (j *Journal) Completed(phase string) bool {
+	return StringSliceContains(j.Phases, phase)
+}
+
+// Complete records that the phase was completed.
+func (j *Journal) Complete(phase string) error {
+	j.Phases = append(j.Phases, phase)
+	return j.save()
+}
+
+// Written returns the number of files written so far.
+func (j *Journal) Written() int {
+	n := 0
+	for _, f := range j.Files {
+		if f.Written {
+			n++
+		}
+	}
+	return n
+}
+
+// FileWritten records that the file at path was written.
+func (j *Journal) FileWritten(path string) error {
+	for _, f := range j.Files {
+		if filepath.Join(j.pluginPath, filepath.FromSlash(f.Path)) == path {
+			f.Written = true
+		}
+	}
+	return j.save()
+}
+
+// Content returns the rewritten content of the file, as recorded when the
+// journal was created.
+func (j *Journal) Content(f *JournalFile) ([]byte, error) {
+	content, err := ioutil.ReadFile(filepath.Join(JournalDir(j.pluginPath), journalFilesDir, filepath.FromSlash(f.Path)))
+	if err != nil {
+		return nil, err
+	}
+	if sum := checksum(content); sum != f.SHA256 {
+		return nil, fmt.Errorf("migration journal is corrupted: checksum of %s is %s, expected %s", f.Path, sum, f.SHA256)
+	}
+	return content, nil
+}
+
+// Change rebuilds the FileChange of the file from its content before the
+// migration, as recorded by backup.
+func (j *Journal) Change(f *JournalFile, backup *BackupManifest) (*FileChange, error) {
+	updated, err := j.Content(f)
+	if err != nil {
+		return nil, err
+	}
+	change := &FileChange{
+		Path:     filepath.Join(j.pluginPath, filepath.FromSlash(f.Path)),
+		Original: []byte{},
+		Updated:  updated,
+		Rewrites: f.Rewrites,
+	}
+	for _, bf := range backup.Files {
+		if bf.Path == f.Path && bf.Existed {
+			change.Original, err = ReadBackupFile(j.pluginPath, backup, bf)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return change, nil
+}
+
+// MatchesContent reports whether content is the rewritten content of the
+// file.
+func (f *JournalFile) MatchesContent(content []byte) bool {
+	return checksum(content) == f.SHA256
+}
+
+func (j *Journal) save() error {
+	content, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filepath.Join(JournalDir(j.pluginPath), journalFilename), content, 0644)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_Journal(t *testing.T) {
+	pluginPath := t.TempDir()
+	mainGo := filepath.Join(pluginPath, "main.go")
+	mustWrite(t, mainGo, "package main\n")
+
+	if j, err := ReadJournal(pluginPath); err != nil || j != nil {
+		t.Fatalf("expected no journal, got %v, %v", j, err)
+	}
+
+	j, err := CreateJournal(pluginPath, "backup", "v0.0.14", []*FileChange{{
+		Path:     mainGo,
+		Original: []byte("package main\n"),
+		Updated:  []byte("package migrated\n"),
+	}})
+	if err != nil {
+		t.Fatalf("CreateJournal: %s", err)
+	}
+	if err := j.Complete("backing up files"); err != nil {
+		t.Fatalf("Complete: %s", err)
+	}
+	if err := j.FileWritten(mainGo); err != nil {
+		t.Fatalf("FileWritten: %s", err)
+	}
+
+	read, err := ReadJournal(pluginPath)
+	if err != nil {
+		t.Fatalf("ReadJournal: %s", err)
+	}
+	if read.BackupID != "backup" || !read.Completed("backing up files") || read.Completed("writing changes") {
+		t.Fatalf("unexpected journal: %+v", read)
+	}
+	if len(read.Files) != 1 || read.Files[0].Path != "main.go" || read.Written() != 1 {
+		t.Fatalf("unexpected journal files: %+v", read.Files)
+	}
+	content, err := read.Content(read.Files[0])
+	if err != nil {
+		t.Fatalf("Content: %s", err)
+	}
+	if string(content) != "package migrated\n" || !read.Files[0].MatchesContent(content) {
+		t.Fatalf("unexpected content: %q", content)
+	}
+
+	if err := read.Remove(); err != nil {
+		t.Fatalf("Remove: %s", err)
+	}
+	if j, err := ReadJournal(pluginPath); err != nil || j != nil {
+		t.Fatalf("expected the journal to be removed, got %v, %v", j, err)
+	}
+}
@@ -0,0 +1,449 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// importRewriter holds the state of the rewrite of the imports of a single
+// file. The file is not reprinted: every change is recorded as an edit of the
+// original source, so comments, formatting and import grouping are kept
+// everywhere else.
+type importRewriter struct {
+	fset  *token.FileSet
+	f     *ast.File
+	tf    *token.File
+	src   []byte
+	rules *Rules
+	refs  *packageRefs
+	opts  *ImportsOptions
+
+	edits   []*edit
+	skipped []*SkippedReference
+	// newImports holds the imports introduced by the rewrite, in the order
+	// they are first needed. Their names are settled by resolveCollisions
+	// once every import has been rewritten.
+	newImports []*newImport
+	// deleteImports maps the import paths of the specs to delete to their
+	// import name.
+	deleteImports map[string]string
+	// importSpecs holds the import names already in use in the file, which
+	// aliases configured by alias rules must not conflict with.
+	importSpecs map[string]*ast.ImportSpec
+	// aliasErr is the first conflict of a configured alias.
+	aliasErr error
+}
+
+// newImportRewriter parses the file. If refs is nil, the file is type-checked
+// on its own.
+func newImportRewriter(filePath string, src []byte, rules *Rules, refs *packageRefs, opts *ImportsOptions) (*importRewriter, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filePath, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if refs == nil {
+		refs = fileRefs(fset, f)
+	}
+
+	r := &importRewriter{
+		fset:          fset,
+		f:             f,
+		tf:            fset.File(f.Pos()),
+		src:           src,
+		rules:         rules,
+		refs:          refs,
+		opts:          opts,
+		edits:         []*edit{},
+		skipped:       []*SkippedReference{},
+		deleteImports: map[string]string{},
+		importSpecs:   map[string]*ast.ImportSpec{},
+	}
+	for _, impSpec := range f.Imports {
+		if impSpec.Name != nil {
+			r.importSpecs[impSpec.Name.Name] = impSpec
+		} else if impPath, err := strconv.Unquote(impSpec.Path.Value); err == nil {
+			r.importSpecs[guessPackageName(impPath)] = impSpec
+		}
+	}
+	return r, nil
+}
+
+func (r *importRewriter) offset(p token.Pos) int {
+	return r.tf.Offset(p)
+}
+
+// isPackageRef reports whether the selector refers to the package imported
+// from impPath, recording unresolved selectors which look like they might.
+func (r *importRewriter) isPackageRef(sel *ast.SelectorExpr, id *ast.Ident, impPath, name string) bool {
+	switch r.refs.kind(r.fset, id, impPath) {
+	case refPackage:
+		return true
+	case refUnknown:
+		if id.Name == name {
+			r.skipped = append(r.skipped, &SkippedReference{
+				Position: r.fset.Position(id.Pos()),
+				Expr:     id.Name + "." + sel.Sel.Name,
+				Reason:   fmt.Sprintf("could not determine whether %s refers to package %s", id.Name, impPath),
+			})
+		}
+	}
+	return false
+}
+
+// importName applies the alias policy to the default name of the import of
+// newImpPath replacing impSpec. explicit reports whether the import needs to
+// be named. Conflicts of derived names are resolved later on by
+// resolveCollisions, but configured aliases are never changed: a configured
+// alias which conflicts is recorded in aliasErr, and the default name is
+// used.
+func (r *importRewriter) importName(impSpec *ast.ImportSpec, newImpPath, name string, explicit bool) (string, bool) {
+	// Dot and blank imports keep their form.
+	if name == "." || name == "_" {
+		return name, explicit
+	}
+	alias, aliasExplicit := r.opts.AliasPolicy.importName(r.rules.Aliases, newImpPath, name, explicit)
+	if alias == name || r.opts.AliasPolicy != AliasTable {
+		return alias, aliasExplicit
+	}
+
+	var conflict *AliasConflictError
+	if other, ok := r.importSpecs[alias]; ok && other != impSpec {
+		conflict = NewAliasConflictError(newImpPath, alias, r.fset.Position(other.Pos()))
+	} else if offset, ok := r.refs.declared[alias]; ok {
+		conflict = NewAliasConflictError(newImpPath, alias, r.fset.Position(r.tf.Pos(offset)))
+	}
+	if conflict != nil {
+		if r.aliasErr == nil {
+			r.aliasErr = conflict
+		}
+		return name, explicit
+	}
+	return alias, aliasExplicit
+}
+
+// rewriteImport records the new imports replacing impSpec, if the package it
+// imports is mapped by the rules.
+func (r *importRewriter) rewriteImport(impSpec *ast.ImportSpec) {
+	impPath, err := strconv.Unquote(impSpec.Path.Value)
+	if err != nil {
+		log.Print(err)
+	}
+
+	name := guessPackageName(impPath)
+	if impSpec.Name != nil {
+		name = impSpec.Name.Name
+	}
+
+	if newImpPath, ok := r.rules.OneToOne[impPath]; ok {
+		r.moveImport(impSpec, impPath, name, newImpPath, false)
+	} else if newImpPath, ok := r.rules.Rename[impPath]; ok {
+		r.moveImport(impSpec, impPath, name, newImpPath, true)
+	} else if _, ok := r.rules.Split[impPath]; ok {
+		log.Printf("Package %s has been refactored into multiple new SDK"+
+			"packages; walking the ast to update each object as required.", impPath)
+		if name == "." || name == "_" {
+			r.splitDotImport(impSpec, impPath, name)
+		} else {
+			r.splitImport(impSpec, impPath, name)
+		}
+	}
+}
+
+// moveImport rewrites the import path of impSpec in place, and records the
+// references to the package named name.
+func (r *importRewriter) moveImport(impSpec *ast.ImportSpec, impPath, name, newImpPath string, renamed bool) {
+	log.Printf("Changing import of %s to %s", impPath, newImpPath)
+	r.edits = append(r.edits, &edit{r.offset(impSpec.Path.Pos()), r.offset(impSpec.Path.End()), strconv.Quote(newImpPath)})
+
+	// Moved packages keep their name, and so do renamed packages imported
+	// with a custom name.
+	defaultName, defaultExplicit := name, impSpec.Name != nil
+	if renamed && impSpec.Name == nil {
+		pathparts := strings.Split(newImpPath, "/")
+		defaultName = pathparts[len(pathparts)-1]
+	}
+	newImpName, explicit := r.importName(impSpec, newImpPath, defaultName, defaultExplicit)
+	imp := &newImport{
+		path:       newImpPath,
+		name:       newImpName,
+		explicit:   explicit,
+		configured: r.opts.AliasPolicy == AliasTable && newImpName != defaultName,
+		spec:       impSpec,
+		replaced:   impSpec,
+	}
+	r.newImports = append(r.newImports, imp)
+
+	// find expressions that reference this package; they are renamed once
+	// the name of the import is settled.
+	ast.Walk(visitFn(func(n ast.Node) {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return
+		}
+		// References are expected to be unresolved if the package keeps its
+		// name, so they are not reported.
+		if newImpName == name {
+			if r.refs.kind(r.fset, id, impPath) == refPackage {
+				imp.uses = append(imp.uses, id)
+			}
+		} else if r.isPackageRef(sel, id, impPath, name) {
+			imp.uses = append(imp.uses, id)
+		}
+	}), r.f)
+}
+
+// splitDotImport replaces a dot or blank import of a split package by imports
+// of the same form of the destination packages in use, or of all of them.
+func (r *importRewriter) splitDotImport(impSpec *ast.ImportSpec, impPath, name string) {
+	destinations := map[string]string{}
+	dests := []string{}
+	for newImportPath, structList := range r.rules.Split[impPath] {
+		for _, val := range structList {
+			destinations[val] = newImportPath
+		}
+		dests = append(dests, newImportPath)
+	}
+	sort.Strings(dests)
+
+	var unmappedIdents []*ast.Ident
+	if name == "." {
+		var unknown []*ast.Ident
+		dests, unknown = unqualifiedUses(r.fset, r.f, r.refs, impPath, destinations)
+		// Unknown identifiers are attributed to the other dot imports of the
+		// file, if any, unless they are known to be declared in the split
+		// package.
+		otherDots := false
+		for _, other := range r.f.Imports {
+			otherDots = otherDots || (other != impSpec && other.Name != nil && other.Name.Name == ".")
+		}
+		for _, id := range unknown {
+			if _, ok := r.rules.Deprecated[impPath][id.Name]; ok || !otherDots {
+				unmappedIdents = append(unmappedIdents, id)
+			}
+		}
+	}
+	for _, id := range unmappedIdents {
+		r.skipped = append(r.skipped, &SkippedReference{
+			Position: r.fset.Position(id.Pos()),
+			Expr:     id.Name,
+			Reason:   fmt.Sprintf("could not map %s to any SDK package; dot import of %s retained", id.Name, impPath),
+		})
+	}
+
+	for _, dest := range dests {
+		r.newImports = append(r.newImports, &newImport{
+			path:       dest,
+			name:       name,
+			explicit:   true,
+			configured: true,
+			replaced:   impSpec,
+		})
+	}
+	if len(unmappedIdents) == 0 {
+		r.deleteImports[impPath] = name
+	}
+}
+
+// splitImport records an import of the destination package of every
+// identifier of the split package referred to. Identifiers missing from the
+// split table are left untouched, and the original import is retained for
+// them.
+func (r *importRewriter) splitImport(impSpec *ast.ImportSpec, impPath, name string) {
+	destinations := map[string]string{}
+	for newImportPath, structList := range r.rules.Split[impPath] {
+		for _, val := range structList {
+			destinations[val] = newImportPath
+		}
+	}
+
+	unmapped := false
+	splitImports := map[string]*newImport{}
+	ast.Walk(visitFn(func(n ast.Node) {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok || !r.isPackageRef(sel, id, impPath, name) {
+			return
+		}
+
+		newImpPath, ok := destinations[sel.Sel.Name]
+		if !ok {
+			unmapped = true
+			r.skipped = append(r.skipped, &SkippedReference{
+				Position: r.fset.Position(id.Pos()),
+				Expr:     id.Name + "." + sel.Sel.Name,
+				Reason:   fmt.Sprintf("%s is not mapped to any SDK package; import of %s retained", sel.Sel.Name, impPath),
+			})
+			return
+		}
+
+		imp, ok := splitImports[newImpPath]
+		if !ok {
+			pathparts := strings.Split(newImpPath, "/")
+			defaultName := pathparts[len(pathparts)-1]
+			// if we were importing with a custom name, retain that
+			// customization and append new path name.
+			if impSpec.Name != nil {
+				defaultName = name + "_" + defaultName
+			}
+			newImpName, explicit := r.importName(impSpec, newImpPath, defaultName, impSpec.Name != nil)
+			imp = &newImport{
+				path:       newImpPath,
+				name:       newImpName,
+				explicit:   explicit,
+				configured: r.opts.AliasPolicy == AliasTable && newImpName != defaultName,
+				replaced:   impSpec,
+			}
+			splitImports[newImpPath] = imp
+			r.newImports = append(r.newImports, imp)
+		}
+		imp.uses = append(imp.uses, id)
+
+		if impSpec.Name == nil {
+			r.deleteImports[impPath] = ""
+		} else {
+			r.deleteImports[impPath] = name
+		}
+	}), r.f)
+
+	if unmapped {
+		delete(r.deleteImports, impPath)
+	}
+}
+
+// untouchedImports returns the names of the imports which are neither
+// rewritten nor deleted, and keep their names: taken maps them to their
+// import path, and untouched is the reverse mapping.
+func (r *importRewriter) untouchedImports() (taken, untouched map[string]string) {
+	taken = map[string]string{}
+	untouched = map[string]string{}
+	for _, impSpec := range r.f.Imports {
+		rewritten := false
+		for _, imp := range r.newImports {
+			rewritten = rewritten || imp.spec == impSpec
+		}
+		impPath, err := strconv.Unquote(impSpec.Path.Value)
+		if _, deleted := r.deleteImports[impPath]; rewritten || deleted || err != nil {
+			continue
+		}
+		if impSpec.Name != nil {
+			if impSpec.Name.Name != "." && impSpec.Name.Name != "_" {
+				taken[impSpec.Name.Name] = impPath
+				untouched[impPath] = impSpec.Name.Name
+			}
+		} else {
+			taken[guessPackageName(impPath)] = impPath
+			untouched[impPath] = guessPackageName(impPath)
+		}
+	}
+	return taken, untouched
+}
+
+// reuseImports marks the new imports of packages the file imports already,
+// as a partially migrated file may, so those imports are reused under their
+// name.
+func (r *importRewriter) reuseImports(untouched map[string]string) {
+	for _, imp := range r.newImports {
+		if name, ok := untouched[imp.path]; ok && imp.name != "." && imp.name != "_" {
+			imp.name = name
+			imp.reused = true
+		}
+	}
+}
+
+// identifierEdits returns the edits renaming the references to the new
+// imports whose name differs from the one they were imported as.
+func (r *importRewriter) identifierEdits() []*edit {
+	edits := []*edit{}
+	for _, imp := range r.newImports {
+		for _, id := range imp.uses {
+			if id.Name != imp.name {
+				log.Printf("renamed %s to %s", id.Name, imp.name)
+				edits = append(edits, &edit{r.offset(id.Pos()), r.offset(id.End()), imp.name})
+			}
+		}
+	}
+	return edits
+}
+
+// importEdits returns the edits naming the imports rewritten in place,
+// adding the new imports and deleting the replaced ones, together with the
+// import paths whose groups may need sorting. The specs of reused imports
+// are deleted rather than rewritten, so the edits already made to their
+// path are dropped from r.edits.
+func (r *importRewriter) importEdits() ([]*edit, map[string]bool) {
+	edits := []*edit{}
+	touched := map[string]bool{}
+	var addImports []*addedImport
+	for _, imp := range r.newImports {
+		if imp.reused {
+			if spec := imp.spec; spec != nil {
+				kept := r.edits[:0]
+				for _, e := range r.edits {
+					if e.start != r.offset(spec.Path.Pos()) {
+						kept = append(kept, e)
+					}
+				}
+				r.edits = kept
+				path, _ := strconv.Unquote(spec.Path.Value)
+				r.deleteImports[path] = ""
+				if spec.Name != nil {
+					r.deleteImports[path] = spec.Name.Name
+				}
+			}
+			continue
+		}
+
+		impName := ""
+		if imp.explicit {
+			impName = imp.name
+		}
+		touched[imp.path] = true
+		if spec := imp.spec; spec == nil {
+			addImports = append(addImports, &addedImport{name: impName, path: imp.path, near: imp.replaced})
+		} else if spec.Name != nil && impName == "" {
+			edits = append(edits, &edit{r.offset(spec.Name.Pos()), r.offset(spec.Path.Pos()), ""})
+		} else if spec.Name == nil && impName != "" {
+			edits = append(edits, &edit{r.offset(spec.Path.Pos()), r.offset(spec.Path.Pos()), impName + " "})
+		} else if spec.Name != nil && spec.Name.Name != impName {
+			edits = append(edits, &edit{r.offset(spec.Name.Pos()), r.offset(spec.Name.End()), impName})
+		}
+	}
+	edits = append(edits, importEdits(r.fset, r.f, r.src, addImports, r.deleteImports)...)
+	return edits, touched
+}
+
+// annotationEdits returns the edits inserting notes, and a note for every
+// skipped reference not explained by one of them already.
+func (r *importRewriter) annotationEdits(notes []*annotation) []*edit {
+	explained := map[token.Pos]bool{}
+	for _, note := range notes {
+		explained[note.node.Pos()] = true
+	}
+	for _, s := range r.skipped {
+		pos := r.tf.Pos(s.Position.Offset)
+		if !explained[pos] {
+			path, _ := astutil.PathEnclosingInterval(r.f, pos, pos)
+			notes = append(notes, &annotation{node: path[0], text: s.Expr + ": " + s.Reason + "."})
+		}
+	}
+	return annotationEdits(r.fset, r.f, r.src, notes)
+}
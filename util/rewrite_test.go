@@ -0,0 +1,161 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testImportRewriter(t *testing.T, src string, opts *ImportsOptions) *importRewriter {
+	t.Helper()
+	r, err := newImportRewriter("input.go", []byte(src), testRules(t), nil, opts)
+	if err != nil {
+		t.Fatalf("newImportRewriter: %s", err)
+	}
+	return r
+}
+
+// applied returns the source of the rewriter with edits applied.
+func applied(t *testing.T, r *importRewriter, edits []*edit) string {
+	t.Helper()
+	out, err := applyEdits(r.src, edits)
+	if err != nil {
+		t.Fatalf("applyEdits: %s", err)
+	}
+	return string(out)
+}
+
+func Test_importRewriter_importName(t *testing.T) {
+	r := testImportRewriter(t, `package main
+
+import (
+	"github.com/hashicorp/packer/packer"
+	"github.com/hashicorp/packer/template/interpolate"
+)
+
+var packersdk packer.Ui
+var _ interpolate.Context
+`, &ImportsOptions{AliasPolicy: AliasTable})
+	packerSpec, interpolateSpec := r.f.Imports[0], r.f.Imports[1]
+
+	// The configured alias of packer is declared in the file, so the default
+	// name is kept and the conflict is reported.
+	name, explicit := r.importName(packerSpec, "github.com/hashicorp/packer-plugin-sdk/packer", "packer", false)
+	if name != "packer" || explicit {
+		t.Fatalf("expected the default name, got %q (explicit: %t)", name, explicit)
+	}
+	conflict, ok := r.aliasErr.(*AliasConflictError)
+	if !ok || conflict.Alias != "packersdk" || conflict.Position.String() != "input.go:8:5" {
+		t.Fatalf("unexpected conflict: %v", r.aliasErr)
+	}
+
+	// Packages without a configured alias keep their default name.
+	name, explicit = r.importName(interpolateSpec, "github.com/hashicorp/packer-plugin-sdk/template/interpolate", "interpolate", false)
+	if name != "interpolate" || explicit {
+		t.Fatalf("expected the default name, got %q (explicit: %t)", name, explicit)
+	}
+
+	// Dot imports keep their form.
+	if name, _ := r.importName(packerSpec, "github.com/hashicorp/packer-plugin-sdk/packer", ".", true); name != "." {
+		t.Fatalf("expected a dot import, got %q", name)
+	}
+}
+
+func Test_importRewriter_splitImport(t *testing.T) {
+	r := testImportRewriter(t, `package main
+
+import "github.com/hashicorp/packer/common"
+
+var _ common.PackerConfig
+var _ = common.StepDownload{}
+var _ = common.NotMapped
+`, &ImportsOptions{})
+	r.splitImport(r.f.Imports[0], "github.com/hashicorp/packer/common", "common")
+
+	paths := []string{}
+	for _, imp := range r.newImports {
+		paths = append(paths, imp.path+" "+imp.name)
+	}
+	expected := []string{
+		"github.com/hashicorp/packer-plugin-sdk/common common",
+		"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps commonsteps",
+	}
+	if diff := cmp.Diff(expected, paths); diff != "" {
+		t.Fatalf("unexpected imports: %s", diff)
+	}
+	if len(r.skipped) != 1 || r.skipped[0].Expr != "common.NotMapped" {
+		t.Fatalf("expected common.NotMapped to be skipped, got %v", r.skipped)
+	}
+	if _, ok := r.deleteImports["github.com/hashicorp/packer/common"]; ok {
+		t.Fatalf("expected the import of common to be retained for NotMapped")
+	}
+}
+
+func Test_importRewriter_identifierEdits(t *testing.T) {
+	r := testImportRewriter(t, `package main
+
+import "github.com/hashicorp/packer/common"
+
+var _ = common.StepDownload{}
+var _ common.PackerConfig
+`, &ImportsOptions{})
+	r.splitImport(r.f.Imports[0], "github.com/hashicorp/packer/common", "common")
+
+	expected := `package main
+
+import "github.com/hashicorp/packer/common"
+
+var _ = commonsteps.StepDownload{}
+var _ common.PackerConfig
+`
+	if diff := cmp.Diff(expected, applied(t, r, r.identifierEdits())); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+}
+
+func Test_importRewriter_importEdits(t *testing.T) {
+	r := testImportRewriter(t, `package main
+
+import (
+	ge "github.com/hashicorp/packer-plugin-sdk/guestexec"
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/provisioner"
+)
+
+var _ = ge.GuestOSType("")
+var _ = provisioner.GuestOSType("")
+var _ = common.StepDownload{}
+`, &ImportsOptions{})
+	for _, impSpec := range r.f.Imports {
+		r.rewriteImport(impSpec)
+	}
+	_, untouched := r.untouchedImports()
+	r.reuseImports(untouched)
+
+	edits, touched := r.importEdits()
+	// The import of provisioner is deleted rather than rewritten, since
+	// guestexec is imported already.
+	if len(r.edits) != 0 {
+		t.Fatalf("expected the edit of the provisioner import path to be dropped, got %d edits", len(r.edits))
+	}
+	expected := `package main
+
+import (
+	ge "github.com/hashicorp/packer-plugin-sdk/guestexec"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+)
+
+var _ = ge.GuestOSType("")
+var _ = provisioner.GuestOSType("")
+var _ = common.StepDownload{}
+`
+	if diff := cmp.Diff(expected, applied(t, r, edits)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+	if diff := cmp.Diff(map[string]bool{"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps": true}, touched); diff != "" {
+		t.Fatalf("unexpected touched imports: %s", diff)
+	}
+}
@@ -0,0 +1,693 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+const (
+	defaultRulesFilename = "default_rules.hcl"
+
+	// DefaultSDKVersion is the SDK version plugins are migrated to unless
+	// another version is requested.
+	DefaultSDKVersion = "v0.0.14"
+)
+
+//go:embed default_rules.hcl
+var defaultRulesSrc []byte
+
+// Rules holds the tables used to map packages from the Packer core module to
+// their new home in the SDK.
+type Rules struct {
+	// OneToOne maps packages that were moved without changing their package
+	// name, so only the import path needs to change.
+	OneToOne map[string]string
+
+	// Rename maps packages that were moved and renamed, so expressions
+	// referencing the package have to be updated as well.
+	Rename map[string]string
+
+	// Split maps packages that got split up into multiple destination
+	// packages to each destination package and the exported identifiers that
+	// ended up there.
+	Split map[string]map[string][]string
+
+	// Deprecated maps Packer core packages to their exported identifiers
+	// that have no direct equivalent in the SDK.
+	Deprecated map[string]map[string]*Deprecation
+
+	// Aliases maps SDK packages to the name they are imported as when the
+	// table alias policy is used.
+	Aliases map[string]string
+
+	// Sources maps each Packer core package mapped by a move, rename or split
+	// rule, and each of its destination packages, to the location of the
+	// rule mapping it there.
+	Sources map[string]map[string]hcl.Range
+}
+
+// Deprecation describes an identifier of a Packer core package which was
+// removed or renamed in the SDK.
+type Deprecation struct {
+	ImportPath string
+	Identifier string
+	Message    string
+	// Replacement is a suggested replacement expression, if there is one.
+	Replacement string
+}
+
+// RuleSet holds every mapping rule known to the migrator, grouped into packs
+// keyed by the SDK versions they apply to.
+type RuleSet struct {
+	packs []*rulePack
+}
+
+type rulePack struct {
+	// constraint is nil for rules that apply to every SDK version.
+	constraint version.Constraints
+	rules      *Rules
+}
+
+// UnsupportedSDKVersionError is returned when no mapping pack is known for the
+// requested SDK version.
+type UnsupportedSDKVersionError struct {
+	Version string
+	Known   []string
+}
+
+func (e *UnsupportedSDKVersionError) Error() string {
+	return fmt.Sprintf("no mapping rules are known for SDK version %s (known versions: %s)",
+		e.Version, strings.Join(e.Known, "; "))
+}
+
+var rulesSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "move", LabelNames: []string{"from"}},
+		{Type: "rename", LabelNames: []string{"from"}},
+		{Type: "split", LabelNames: []string{"from"}},
+		{Type: "deprecated", LabelNames: []string{"package", "identifier"}},
+		{Type: "alias", LabelNames: []string{"package"}},
+		{Type: "sdk", LabelNames: []string{"versions"}},
+	},
+}
+
+var packSchema = &hcl.BodySchema{
+	Blocks: rulesSchema.Blocks[:5],
+}
+
+var splitSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "into", LabelNames: []string{"to"}},
+	},
+}
+
+type pathRule struct {
+	To string `hcl:"to"`
+}
+
+type splitTarget struct {
+	Identifiers []string `hcl:"identifiers"`
+}
+
+type deprecationRule struct {
+	Message     string `hcl:"message"`
+	Replacement string `hcl:"replacement,optional"`
+}
+
+type aliasRule struct {
+	Name string `hcl:"name"`
+}
+
+// RulesError is returned when a rules file cannot be parsed or is invalid. It
+// renders the HCL diagnostics together with the offending source lines.
+type RulesError struct {
+	Diags hcl.Diagnostics
+	files map[string]*hcl.File
+}
+
+func (re *RulesError) Error() string {
+	var buf bytes.Buffer
+	wr := hcl.NewDiagnosticTextWriter(&buf, re.files, 0, false)
+	if err := wr.WriteDiagnostics(re.Diags); err != nil {
+		return re.Diags.Error()
+	}
+	return buf.String()
+}
+
+func NewRulesError(diags hcl.Diagnostics, files map[string]*hcl.File) *RulesError {
+	return &RulesError{diags, files}
+}
+
+// DefaultRules returns a fresh copy of the rules built into the migrator.
+func DefaultRules() *RuleSet {
+	rs, err := ParseRules(defaultRulesFilename, defaultRulesSrc)
+	if err != nil {
+		panic(fmt.Sprintf("built-in rules are invalid: %s", err))
+	}
+	return rs
+}
+
+// LoadRules returns the built-in rules, extended and overridden by the rules
+// file at path. An empty path returns the built-in rules unchanged.
+func LoadRules(path string) (*RuleSet, error) {
+	rs := DefaultRules()
+	if path == "" {
+		return rs, nil
+	}
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	override, err := ParseRules(path, src)
+	if err != nil {
+		return nil, err
+	}
+	rs.packs = append(rs.packs, override.packs...)
+
+	return rs, nil
+}
+
+// ParseRules parses an HCL rules file. Any problem with the file is returned
+// as a *RulesError.
+func ParseRules(filename string, src []byte) (*RuleSet, error) {
+	p := hclparse.NewParser()
+	f, diags := p.ParseHCL(src, filename)
+	if diags.HasErrors() {
+		return nil, NewRulesError(diags, p.Files())
+	}
+
+	rs, diags := decodeRuleSet(f.Body)
+	if diags.HasErrors() {
+		return nil, NewRulesError(diags, p.Files())
+	}
+
+	return rs, nil
+}
+
+// ForVersion returns the rules to apply when migrating to sdkVersion: the
+// rules common to all versions, overridden by every pack matching the
+// version, in the order they were declared.
+func (rs *RuleSet) ForVersion(sdkVersion string) (*Rules, error) {
+	v, err := version.NewVersion(sdkVersion)
+	if err != nil {
+		return nil, &UnsupportedSDKVersionError{sdkVersion, rs.Versions()}
+	}
+
+	rules := newRules()
+	matched := false
+	for _, pack := range rs.packs {
+		if pack.constraint == nil {
+			rules.Override(pack.rules)
+		} else if pack.constraint.Check(v) {
+			rules.Override(pack.rules)
+			matched = true
+		}
+	}
+	if !matched {
+		return nil, &UnsupportedSDKVersionError{sdkVersion, rs.Versions()}
+	}
+
+	return rules, nil
+}
+
+// ForReference returns the rules to apply when migrating to ref, an SDK
+// release version or a git reference such as master. The newest known rules
+// are used for references which are not release versions, in which case
+// fallback is set.
+func (rs *RuleSet) ForReference(ref string) (rules *Rules, fallback bool, err error) {
+	if !IsReleaseVersion(ref) {
+		return rs.Latest(), true, nil
+	}
+	rules, err = rs.ForVersion(ref)
+	return rules, false, err
+}
+
+// IsReleaseVersion reports whether sdkVersion is a release version, rather
+// than a branch name or a module query such as latest.
+func IsReleaseVersion(sdkVersion string) bool {
+	_, err := version.NewVersion(sdkVersion)
+	return err == nil
+}
+
+// Latest returns the rules common to all versions overridden by every pack
+// for the newest SDK versions, in the order they were declared, like
+// ForVersion merges every pack matching a version. These are the packs whose
+// constraint admits the highest versions. It is used when the requested SDK
+// version is not known, e.g. a branch name.
+func (rs *RuleSet) Latest() *Rules {
+	var newest versionBound
+	found := false
+	for _, pack := range rs.packs {
+		if pack.constraint == nil {
+			continue
+		}
+		if b := upperBound(pack.constraint); !found || newerBound(b, newest) {
+			newest, found = b, true
+		}
+	}
+
+	rules := newRules()
+	for _, pack := range rs.packs {
+		if pack.constraint == nil || !newerBound(newest, upperBound(pack.constraint)) {
+			rules.Override(pack.rules)
+		}
+	}
+	return rules
+}
+
+// versionBound is the upper bound of a version constraint. A nil version
+// means the constraint is unbounded.
+type versionBound struct {
+	version   *version.Version
+	inclusive bool
+}
+
+// upperBound returns the upper bound of the versions admitted by every
+// constraint of cs.
+func upperBound(cs version.Constraints) versionBound {
+	bound := versionBound{}
+	for _, c := range cs {
+		fields := strings.Fields(c.String())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := version.NewVersion(fields[1])
+		if err != nil {
+			continue
+		}
+		var b versionBound
+		switch fields[0] {
+		case "<":
+			b = versionBound{v, false}
+		case "<=", "=":
+			b = versionBound{v, true}
+		case "~>":
+			// ~> 1.2.3 admits versions below 1.3.0, and ~> 1.2 below 2.0.
+			segments := v.Segments()
+			n := strings.Count(fields[1], ".")
+			if n == 0 {
+				n = 1
+			}
+			segments[n-1]++
+			upper := make([]string, n)
+			for i := range upper {
+				upper[i] = strconv.Itoa(segments[i])
+			}
+			if u, err := version.NewVersion(strings.Join(upper, ".")); err == nil {
+				b = versionBound{u, false}
+			}
+		}
+		if b.version != nil && newerBound(bound, b) {
+			bound = b
+		}
+	}
+	return bound
+}
+
+// newerBound reports whether the bound a admits newer versions than b.
+func newerBound(a, b versionBound) bool {
+	switch {
+	case a.version == nil:
+		return b.version != nil
+	case b.version == nil:
+		return false
+	case a.version.Equal(b.version):
+		return a.inclusive && !b.inclusive
+	}
+	return a.version.GreaterThan(b.version)
+}
+
+// Versions returns the version constraints of all known mapping packs.
+func (rs *RuleSet) Versions() []string {
+	versions := []string{}
+	for _, pack := range rs.packs {
+		if pack.constraint != nil {
+			versions = append(versions, pack.constraint.String())
+		}
+	}
+	return versions
+}
+
+func newRules() *Rules {
+	return &Rules{
+		OneToOne:   map[string]string{},
+		Rename:     map[string]string{},
+		Split:      map[string]map[string][]string{},
+		Deprecated: map[string]map[string]*Deprecation{},
+		Aliases:    map[string]string{},
+		Sources:    map[string]map[string]hcl.Range{},
+	}
+}
+
+func decodeRuleSet(body hcl.Body) (*RuleSet, hcl.Diagnostics) {
+	content, diags := body.Content(rulesSchema)
+
+	common, moreDiags := decodeRules(content.Blocks)
+	diags = append(diags, moreDiags...)
+	rs := &RuleSet{
+		packs: []*rulePack{{rules: common}},
+	}
+
+	for _, block := range content.Blocks.OfType("sdk") {
+		constraint, err := version.NewConstraint(block.Labels[0])
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid SDK version constraint",
+				Detail:   fmt.Sprintf("Could not parse %q: %s.", block.Labels[0], err),
+				Subject:  block.LabelRanges[0].Ptr(),
+			})
+			continue
+		}
+
+		packContent, moreDiags := block.Body.Content(packSchema)
+		diags = append(diags, moreDiags...)
+		rules, moreDiags := decodeRules(packContent.Blocks)
+		diags = append(diags, moreDiags...)
+
+		rs.packs = append(rs.packs, &rulePack{constraint, rules})
+	}
+
+	return rs, diags
+}
+
+func decodeRules(blocks hcl.Blocks) (*Rules, hcl.Diagnostics) {
+	rules := newRules()
+	var diags hcl.Diagnostics
+
+	// A package may only be mapped once per pack, regardless of the kind of
+	// rule used to map it.
+	seen := map[string]*hcl.Block{}
+	// An alias may only be used for a single package per pack.
+	aliased := map[string]*hcl.Block{}
+
+	for _, block := range blocks {
+		if block.Type == "sdk" {
+			continue
+		}
+		if block.Type == "deprecated" {
+			d, moreDiags := decodeDeprecation(block)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			if _, ok := rules.Deprecated[d.ImportPath][d.Identifier]; ok {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate deprecation",
+					Detail:   fmt.Sprintf("Identifier %s of %q is already deprecated.", d.Identifier, d.ImportPath),
+					Subject:  block.DefRange.Ptr(),
+				})
+				continue
+			}
+			rules.addDeprecation(d)
+			continue
+		}
+		if block.Type == "alias" {
+			alias, moreDiags := decodeAlias(block)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			if prev, ok := aliased[alias]; ok {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate alias",
+					Detail: fmt.Sprintf("Alias %s is already used for %q by the rule at %s.",
+						alias, prev.Labels[0], prev.DefRange),
+					Subject: block.DefRange.Ptr(),
+				})
+				continue
+			}
+			if _, ok := rules.Aliases[block.Labels[0]]; ok {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate alias",
+					Detail:   fmt.Sprintf("Package %q already has an alias.", block.Labels[0]),
+					Subject:  block.LabelRanges[0].Ptr(),
+				})
+				continue
+			}
+			aliased[alias] = block
+			rules.Aliases[block.Labels[0]] = alias
+			continue
+		}
+
+		from := block.Labels[0]
+		if prev, ok := seen[from]; ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate package rule",
+				Detail: fmt.Sprintf("Package %q was already mapped by the %s rule at %s.",
+					from, prev.Type, prev.DefRange),
+				Subject: block.LabelRanges[0].Ptr(),
+			})
+			continue
+		}
+		seen[from] = block
+
+		switch block.Type {
+		case "move", "rename":
+			var rule pathRule
+			moreDiags := gohcl.DecodeBody(block.Body, nil, &rule)
+			diags = append(diags, moreDiags...)
+			if moreDiags.HasErrors() {
+				continue
+			}
+			if rule.To == "" {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Missing destination package",
+					Detail:   fmt.Sprintf("The %s rule for %q must set a non-empty \"to\" import path.", block.Type, from),
+					Subject:  block.Body.MissingItemRange().Ptr(),
+				})
+				continue
+			}
+			if block.Type == "move" {
+				rules.OneToOne[from] = rule.To
+			} else {
+				rules.Rename[from] = rule.To
+			}
+			rules.Sources[from] = map[string]hcl.Range{rule.To: block.DefRange}
+		case "split":
+			targets, sources, moreDiags := decodeSplit(block)
+			diags = append(diags, moreDiags...)
+			if !moreDiags.HasErrors() {
+				rules.Split[from] = targets
+				rules.Sources[from] = sources
+			}
+		}
+	}
+
+	return rules, diags
+}
+
+func decodeSplit(block *hcl.Block) (map[string][]string, map[string]hcl.Range, hcl.Diagnostics) {
+	from := block.Labels[0]
+	targets := map[string][]string{}
+	sources := map[string]hcl.Range{}
+
+	content, diags := block.Body.Content(splitSchema)
+	if len(content.Blocks) == 0 && !diags.HasErrors() {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Empty package split",
+			Detail:   fmt.Sprintf("The split rule for %q must contain at least one \"into\" block.", from),
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+
+	// An identifier can only end up in one destination package.
+	destinations := map[string]string{}
+
+	for _, into := range content.Blocks {
+		to := into.Labels[0]
+		if _, ok := targets[to]; ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Duplicate split destination",
+				Detail:   fmt.Sprintf("Package %q is listed more than once in the split rule for %q.", to, from),
+				Subject:  into.LabelRanges[0].Ptr(),
+			})
+			continue
+		}
+
+		var target splitTarget
+		moreDiags := gohcl.DecodeBody(into.Body, nil, &target)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+
+		for _, ident := range target.Identifiers {
+			if prev, ok := destinations[ident]; ok {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate split identifier",
+					Detail:   fmt.Sprintf("Identifier %q is already mapped to %q.", ident, prev),
+					Subject:  into.DefRange.Ptr(),
+				})
+				continue
+			}
+			destinations[ident] = to
+		}
+		targets[to] = target.Identifiers
+		sources[to] = into.DefRange
+	}
+
+	return targets, sources, diags
+}
+
+func decodeDeprecation(block *hcl.Block) (*Deprecation, hcl.Diagnostics) {
+	var rule deprecationRule
+	diags := gohcl.DecodeBody(block.Body, nil, &rule)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if rule.Message == "" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing deprecation message",
+			Detail: fmt.Sprintf("The deprecation of %s in %q must set a non-empty message.",
+				block.Labels[1], block.Labels[0]),
+			Subject: block.DefRange.Ptr(),
+		})
+		return nil, diags
+	}
+
+	return &Deprecation{
+		ImportPath:  block.Labels[0],
+		Identifier:  block.Labels[1],
+		Message:     rule.Message,
+		Replacement: rule.Replacement,
+	}, diags
+}
+
+func decodeAlias(block *hcl.Block) (string, hcl.Diagnostics) {
+	var rule aliasRule
+	diags := gohcl.DecodeBody(block.Body, nil, &rule)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	if !token.IsIdentifier(rule.Name) || rule.Name == "_" {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid alias",
+			Detail:   fmt.Sprintf("The alias of %q must be a Go identifier, got %q.", block.Labels[0], rule.Name),
+			Subject:  block.DefRange.Ptr(),
+		})
+		return "", diags
+	}
+
+	return rule.Name, diags
+}
+
+// Deprecations returns all deprecated identifiers, sorted by package and
+// identifier.
+func (r *Rules) Deprecations() []*Deprecation {
+	deprecations := []*Deprecation{}
+	for _, idents := range r.Deprecated {
+		for _, d := range idents {
+			deprecations = append(deprecations, d)
+		}
+	}
+	sort.Slice(deprecations, func(i, j int) bool {
+		if deprecations[i].ImportPath != deprecations[j].ImportPath {
+			return deprecations[i].ImportPath < deprecations[j].ImportPath
+		}
+		return deprecations[i].Identifier < deprecations[j].Identifier
+	})
+	return deprecations
+}
+
+func (r *Rules) addDeprecation(d *Deprecation) {
+	if r.Deprecated[d.ImportPath] == nil {
+		r.Deprecated[d.ImportPath] = map[string]*Deprecation{}
+	}
+	r.Deprecated[d.ImportPath][d.Identifier] = d
+}
+
+// Override applies the rules in o on top of r. A package mapped in o replaces
+// any existing rule for that package, except for package splits present in
+// both, where identifiers listed in o are moved to their new destination and
+// all other identifiers keep their existing mapping. Deprecations and aliases
+// in o replace existing ones for the same identifier or package.
+func (r *Rules) Override(o *Rules) {
+	for from, to := range o.OneToOne {
+		r.remove(from)
+		r.OneToOne[from] = to
+		r.Sources[from] = o.Sources[from]
+	}
+	for from, to := range o.Rename {
+		r.remove(from)
+		r.Rename[from] = to
+		r.Sources[from] = o.Sources[from]
+	}
+	for from, targets := range o.Split {
+		existing, ok := r.Split[from]
+		if !ok {
+			r.remove(from)
+			existing = map[string][]string{}
+			r.Split[from] = existing
+			r.Sources[from] = map[string]hcl.Range{}
+		}
+		for to, rng := range o.Sources[from] {
+			r.Sources[from][to] = rng
+		}
+		for to, idents := range targets {
+			for _, ident := range idents {
+				for prevTo, prevIdents := range existing {
+					existing[prevTo] = removeString(prevIdents, ident)
+				}
+			}
+			existing[to] = append(existing[to], idents...)
+		}
+		for to, idents := range existing {
+			if len(idents) == 0 {
+				delete(existing, to)
+				delete(r.Sources[from], to)
+			}
+		}
+	}
+	for _, idents := range o.Deprecated {
+		for _, d := range idents {
+			r.addDeprecation(d)
+		}
+	}
+	for pkg, alias := range o.Aliases {
+		r.Aliases[pkg] = alias
+	}
+}
+
+func (r *Rules) remove(from string) {
+	delete(r.OneToOne, from)
+	delete(r.Rename, from)
+	delete(r.Split, from)
+	delete(r.Sources, from)
+}
+
+func removeString(ss []string, s string) []string {
+	out := ss[:0]
+	for _, i := range ss {
+		if i != s {
+			out = append(out, i)
+		}
+	}
+	return out
+}
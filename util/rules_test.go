@@ -0,0 +1,243 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_DefaultRules(t *testing.T) {
+	rules, err := DefaultRules().ForVersion(DefaultSDKVersion)
+	if err != nil {
+		t.Fatalf("ForVersion: %s", err)
+	}
+
+	if got := rules.OneToOne["github.com/hashicorp/packer/packer"]; got != "github.com/hashicorp/packer-plugin-sdk/packer" {
+		t.Fatalf("unexpected one-to-one mapping for packer: %q", got)
+	}
+	if got := rules.Rename["github.com/hashicorp/packer/provisioner"]; got != "github.com/hashicorp/packer-plugin-sdk/guestexec" {
+		t.Fatalf("unexpected rename mapping for provisioner: %q", got)
+	}
+	if _, ok := rules.Split["github.com/hashicorp/packer/common"]["github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"]; !ok {
+		t.Fatalf("expected split of common into commonsteps")
+	}
+	// NewGuestCommands lives in provisioner, which is renamed to guestexec.
+	for target, idents := range rules.Split["github.com/hashicorp/packer/common"] {
+		if StringSliceContains(idents, "NewGuestCommands") {
+			t.Fatalf("unexpected split of NewGuestCommands from common into %s", target)
+		}
+	}
+}
+
+func Test_RuleSet_ForVersion(t *testing.T) {
+	tc := []struct {
+		version    string
+		hcl2helper bool
+	}{
+		{"v0.0.6", false},
+		{"v0.0.8", true},
+		{"v0.0.14", true},
+		{"0.4.2", true},
+	}
+
+	for _, tc := range tc {
+		t.Run(tc.version, func(t *testing.T) {
+			rules, err := DefaultRules().ForVersion(tc.version)
+			if err != nil {
+				t.Fatalf("ForVersion: %s", err)
+			}
+			split := rules.Split["github.com/hashicorp/packer/hcl2template"]
+			if _, ok := split["github.com/hashicorp/packer-plugin-sdk/hcl2helper"]; ok != tc.hcl2helper {
+				t.Fatalf("expected hcl2helper mapping: %t, got %t", tc.hcl2helper, ok)
+			}
+			if _, ok := split["github.com/hashicorp/packer-plugin-sdk/template/config"]; !ok {
+				t.Fatalf("expected template/config mapping")
+			}
+		})
+	}
+
+	for _, v := range []string{"v0.0.1", "v0.5.0", "master"} {
+		t.Run(v, func(t *testing.T) {
+			_, err := DefaultRules().ForVersion(v)
+			if _, ok := err.(*UnsupportedSDKVersionError); !ok {
+				t.Fatalf("expected *UnsupportedSDKVersionError, got %#v", err)
+			}
+		})
+	}
+}
+
+func Test_RuleSet_ForReference(t *testing.T) {
+	_, fallback, err := DefaultRules().ForReference("master")
+	if err != nil || !fallback {
+		t.Fatalf("expected the newest rules for a branch name, got %t, %v", fallback, err)
+	}
+	_, fallback, err = DefaultRules().ForReference(DefaultSDKVersion)
+	if err != nil || fallback {
+		t.Fatalf("expected the rules of %s, got %t, %v", DefaultSDKVersion, fallback, err)
+	}
+	_, _, err = DefaultRules().ForReference("v0.5.0")
+	if _, ok := err.(*UnsupportedSDKVersionError); !ok {
+		t.Fatalf("expected *UnsupportedSDKVersionError, got %#v", err)
+	}
+}
+
+func Test_RuleSet_Latest(t *testing.T) {
+	tc := []struct {
+		versions string
+		used     bool
+		// builtin tells whether the built-in pack for the newest versions
+		// is used too.
+		builtin bool
+	}{
+		{">= 0.0.6, < 0.0.8", false, true},
+		{"~> 0.0.9", false, true},
+		{">= 0.5.0", true, false},
+		{">= 0.0.8, <= 0.5.0", true, false},
+		{">= 0.0.8, < 0.5.0", true, true},
+	}
+
+	for _, tc := range tc {
+		t.Run(tc.versions, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.hcl")
+			mustWrite(t, path, `sdk "`+tc.versions+`" {
+  move "github.com/hashicorp/packer/marker" {
+    to = "example.com/marker"
+  }
+}
+`)
+			rs, err := LoadRules(path)
+			if err != nil {
+				t.Fatalf("LoadRules: %s", err)
+			}
+			_, ok := rs.Latest().OneToOne["github.com/hashicorp/packer/marker"]
+			if ok != tc.used {
+				t.Fatalf("expected the pack of the rules file to be used: %t, got %t", tc.used, ok)
+			}
+			split := rs.Latest().Split["github.com/hashicorp/packer/hcl2template"]
+			if _, ok := split["github.com/hashicorp/packer-plugin-sdk/hcl2helper"]; ok != tc.builtin {
+				t.Fatalf("expected the built-in pack to be used: %t, got %t", tc.builtin, ok)
+			}
+		})
+	}
+}
+
+func Test_Rules_Override(t *testing.T) {
+	rules := testRules(t)
+	override, err := ParseRules("override.hcl", []byte(`
+rename "github.com/hashicorp/packer/common/uuid" {
+  to = "github.com/example/uuid"
+}
+split "github.com/hashicorp/packer/common" {
+  into "github.com/hashicorp/packer-plugin-sdk/common" {
+    identifiers = ["CDConfig", "NewThing"]
+  }
+}
+deprecated "github.com/hashicorp/packer/common" "Retry" {
+  message = "Use our retry helper."
+}
+alias "github.com/hashicorp/packer-plugin-sdk/packer" {
+  name = "sdkpacker"
+}
+`))
+	if err != nil {
+		t.Fatalf("ParseRules: %s", err)
+	}
+	rules.Override(override.Latest())
+
+	if _, ok := rules.OneToOne["github.com/hashicorp/packer/common/uuid"]; ok {
+		t.Fatalf("expected one-to-one mapping of uuid to be replaced")
+	}
+	if got := rules.Rename["github.com/hashicorp/packer/common/uuid"]; got != "github.com/example/uuid" {
+		t.Fatalf("unexpected rename mapping for uuid: %q", got)
+	}
+
+	split := rules.Split["github.com/hashicorp/packer/common"]
+	if StringSliceContains(split["github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"], "CDConfig") {
+		t.Fatalf("expected CDConfig to be removed from commonsteps")
+	}
+	for _, ident := range []string{"CDConfig", "NewThing", "PackerConfig"} {
+		if !StringSliceContains(split["github.com/hashicorp/packer-plugin-sdk/common"], ident) {
+			t.Fatalf("expected %s to be mapped to common", ident)
+		}
+	}
+
+	d := rules.Deprecated["github.com/hashicorp/packer/common"]["Retry"]
+	if d == nil || d.Message != "Use our retry helper." || d.Replacement != "" {
+		t.Fatalf("expected deprecation of Retry to be replaced, got %#v", d)
+	}
+	if rules.Deprecated["github.com/hashicorp/packer/packer"]["ExpandUser"] == nil {
+		t.Fatalf("expected built-in deprecation of ExpandUser to be kept")
+	}
+	if got := rules.Aliases["github.com/hashicorp/packer-plugin-sdk/packer"]; got != "sdkpacker" {
+		t.Fatalf("expected alias of packer to be replaced, got %q", got)
+	}
+}
+
+func Test_ParseRules_diagnostics(t *testing.T) {
+	tc := []struct {
+		name     string
+		src      string
+		expected []string
+	}{
+		{
+			"missing destination",
+			"move \"github.com/hashicorp/packer/a\" {\n}\n",
+			[]string{"Missing required argument", "bad.hcl line 1"},
+		},
+		{
+			"duplicate package",
+			"move \"github.com/hashicorp/packer/a\" {\n  to = \"x\"\n}\nrename \"github.com/hashicorp/packer/a\" {\n  to = \"y\"\n}\n",
+			[]string{"Duplicate package rule", "bad.hcl line 4"},
+		},
+		{
+			"duplicate identifier",
+			"split \"github.com/hashicorp/packer/a\" {\n  into \"x\" {\n    identifiers = [\"A\"]\n  }\n  into \"y\" {\n    identifiers = [\"A\"]\n  }\n}\n",
+			[]string{"Duplicate split identifier", "bad.hcl line 5"},
+		},
+		{
+			"invalid version constraint",
+			"sdk \"not a version\" {\n}\n",
+			[]string{"Invalid SDK version constraint", "bad.hcl line 1"},
+		},
+		{
+			"empty deprecation message",
+			"deprecated \"github.com/hashicorp/packer/a\" \"A\" {\n  message = \"\"\n}\n",
+			[]string{"Missing deprecation message", "bad.hcl line 1"},
+		},
+		{
+			"invalid alias",
+			"alias \"github.com/hashicorp/packer-plugin-sdk/a\" {\n  name = \"a-b\"\n}\n",
+			[]string{"Invalid alias", "bad.hcl line 1"},
+		},
+		{
+			"duplicate alias",
+			"alias \"github.com/hashicorp/packer-plugin-sdk/a\" {\n  name = \"x\"\n}\nalias \"github.com/hashicorp/packer-plugin-sdk/b\" {\n  name = \"x\"\n}\n",
+			[]string{"Duplicate alias", "bad.hcl line 4"},
+		},
+		{
+			"unknown block",
+			"moved \"github.com/hashicorp/packer/a\" {\n}\n",
+			[]string{"Unsupported block type", "bad.hcl line 1"},
+		},
+	}
+
+	for _, tc := range tc {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseRules("bad.hcl", []byte(tc.src))
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if _, ok := err.(*RulesError); !ok {
+				t.Fatalf("expected *RulesError, got %T", err)
+			}
+			for _, e := range tc.expected {
+				if !strings.Contains(err.Error(), e) {
+					t.Fatalf("expected error to contain %q, got: %s", e, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// missingPackageREs match the errors printed by go mod tidy for an import path
+// which no module provides. The last submatch is the import path.
+var missingPackageREs = []*regexp.Regexp{
+	regexp.MustCompile(`module \S+ found \([^)]*\), but does not contain package (\S+)`),
+	regexp.MustCompile(`cannot find module providing package (\S+)`),
+	regexp.MustCompile(`no required module provides package (\S+?);`),
+	regexp.MustCompile(`malformed import path "([^"]+)"`),
+}
+
+// MappingError explains a go mod tidy failure caused by a mapping rule
+// pointing to a package which does not exist.
+type MappingError struct {
+	// Package is the import path go mod tidy could not resolve.
+	Package string
+	// Message is the error reported for it by go mod tidy.
+	Message string
+
+	// Kind is the kind of the mapping rule, e.g. "move", and From the
+	// Packer core package it maps to Package.
+	Kind string
+	From string
+	// Source is the location of the rule, if known.
+	Source hcl.Range
+
+	// Importers lists the imports of Package in the rewritten files.
+	Importers []token.Position
+	// Suggestion is a corrected import path for Package, if one can be
+	// guessed.
+	Suggestion string
+}
+
+func (me *MappingError) String() string {
+	return fmt.Sprintf("%s: the %s rule for %s maps it to %s", me.Message, me.Kind, me.From, me.Package)
+}
+
+// SuggestedRule returns the rule fixing the mapping, to be passed with
+// --rules, or an empty string if there is no suggestion.
+func (me *MappingError) SuggestedRule() string {
+	if me.Suggestion == "" {
+		return ""
+	}
+	if me.Kind == "split" {
+		return fmt.Sprintf("split %q {\n  into %q {\n    identifiers = [...]\n  }\n}\n", me.From, me.Suggestion)
+	}
+	return fmt.Sprintf("%s %q {\n  to = %q\n}\n", me.Kind, me.From, me.Suggestion)
+}
+
+// DiagnoseTidyError maps the packages go mod tidy failed to resolve, according
+// to its stderr, back to the mapping rules which introduced them and to the
+// rewritten files importing them. Failures unrelated to a mapping rule are
+// not returned.
+func DiagnoseTidyError(stderr string, rules *Rules, changes []*FileChange) []*MappingError {
+	errors := []*MappingError{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		for _, re := range missingPackageREs {
+			m := re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			pkg := m[len(m)-1]
+			if seen[pkg] {
+				break
+			}
+			seen[pkg] = true
+
+			me := mappingErrorFor(pkg, rules)
+			if me == nil {
+				break
+			}
+			me.Message = strings.TrimPrefix(line, pkg+": ")
+			me.Importers = importersOf(pkg, changes)
+			if dir, file := path.Split(pkg); strings.HasSuffix(file, ".go") {
+				// Import paths name packages, not files.
+				me.Suggestion = strings.TrimSuffix(dir, "/")
+			}
+			errors = append(errors, me)
+			break
+		}
+	}
+	return errors
+}
+
+// mappingErrorFor returns the rule mapping a package to pkg, or nil if there
+// is none.
+func mappingErrorFor(pkg string, rules *Rules) *MappingError {
+	froms := []string{}
+	for from := range rules.Sources {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+
+	for _, from := range froms {
+		kind := ""
+		switch {
+		case rules.OneToOne[from] == pkg:
+			kind = "move"
+		case rules.Rename[from] == pkg:
+			kind = "rename"
+		default:
+			if _, ok := rules.Split[from][pkg]; ok {
+				kind = "split"
+			}
+		}
+		if kind != "" {
+			return &MappingError{
+				Package: pkg,
+				Kind:    kind,
+				From:    from,
+				Source:  rules.Sources[from][pkg],
+			}
+		}
+	}
+	return nil
+}
+
+// importersOf returns the positions of the imports of pkg in the rewritten
+// files.
+func importersOf(pkg string, changes []*FileChange) []token.Position {
+	positions := []token.Position{}
+	for _, change := range changes {
+		if !strings.HasSuffix(change.Path, ".go") {
+			continue
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, change.Path, change.Updated, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range f.Imports {
+			if impPath, _ := strconv.Unquote(spec.Path.Value); impPath == pkg {
+				positions = append(positions, fset.Position(spec.Pos()))
+			}
+		}
+	}
+	return positions
+}
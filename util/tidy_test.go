@@ -0,0 +1,57 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_DiagnoseTidyError(t *testing.T) {
+	rules := testRules(t)
+	stderr := `go: finding module for package github.com/hashicorp/packer-plugin-sdk/shell-local/config.go
+go: finding module for package github.com/example/missing
+example.com/plugin imports
+	github.com/hashicorp/packer-plugin-sdk/shell-local/config.go: module github.com/hashicorp/packer-plugin-sdk@latest found (v0.0.14), but does not contain package github.com/hashicorp/packer-plugin-sdk/shell-local/config.go
+example.com/plugin imports
+	github.com/example/missing: cannot find module providing package github.com/example/missing
+`
+	changes := []*FileChange{
+		{Path: "go.mod", Updated: []byte("module example.com/plugin\n")},
+		{Path: "main.go", Updated: []byte(`package main
+
+import (
+	"fmt"
+	sl "github.com/hashicorp/packer-plugin-sdk/shell-local/config.go"
+)
+`)},
+	}
+
+	errs := DiagnoseTidyError(stderr, rules, changes)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 mapping error, got %v", errs)
+	}
+	me := errs[0]
+	if me.Kind != "move" || me.From != "github.com/hashicorp/packer/common/shell-local" {
+		t.Fatalf("unexpected rule: %s %s", me.Kind, me.From)
+	}
+	if me.Source.Filename != defaultRulesFilename || me.Source.Start.Line == 0 {
+		t.Fatalf("unexpected rule source: %s", me.Source)
+	}
+	if me.Message != "module github.com/hashicorp/packer-plugin-sdk@latest found (v0.0.14), but does not contain package github.com/hashicorp/packer-plugin-sdk/shell-local/config.go" {
+		t.Fatalf("unexpected message: %s", me.Message)
+	}
+	if len(me.Importers) != 1 || me.Importers[0].String() != "main.go:5:2" {
+		t.Fatalf("unexpected importers: %v", me.Importers)
+	}
+
+	expected := `move "github.com/hashicorp/packer/common/shell-local" {
+  to = "github.com/hashicorp/packer-plugin-sdk/shell-local"
+}
+`
+	if diff := cmp.Diff(expected, me.SuggestedRule()); diff != "" {
+		t.Fatalf("unexpected suggestion: %s", diff)
+	}
+}
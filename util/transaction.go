@@ -0,0 +1,196 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Transaction applies a set of file changes as a unit. Changes are staged to
+// temporary files first and then moved into place with a rename, so each file
+// is either fully written or untouched. Every file the transaction writes, as
+// well as any file tracked explicitly, can be rolled back to its original
+// content if a later step of the migration fails.
+type Transaction struct {
+	// Written, if set, is called by Commit after each file is moved into
+	// place. If it fails, Commit stops.
+	Written func(path string) error
+
+	staged    []*stagedFile
+	originals map[string]*originalFile
+	order     []string
+}
+
+type stagedFile struct {
+	tmpPath string
+	path    string
+}
+
+type originalFile struct {
+	existed bool
+	content []byte
+	mode    os.FileMode
+}
+
+func NewTransaction() *Transaction {
+	return &Transaction{
+		originals: map[string]*originalFile{},
+	}
+}
+
+// Track records the current state of the file at path so it is restored on
+// rollback. This is needed for files modified by external commands, such as
+// go.sum being rewritten by `go mod tidy`.
+func (tx *Transaction) Track(path string) error {
+	if _, ok := tx.originals[path]; ok {
+		return nil
+	}
+
+	orig := &originalFile{mode: 0644}
+	info, err := os.Stat(path)
+	if err == nil {
+		orig.existed = true
+		orig.mode = info.Mode().Perm()
+		orig.content, err = ioutil.ReadFile(path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	tx.originals[path] = orig
+	tx.order = append(tx.order, path)
+	return nil
+}
+
+// Stage writes the updated content of the change to a temporary file next to
+// its destination. Nothing is visible at the destination until Commit.
+func (tx *Transaction) Stage(change *FileChange) error {
+	if err := tx.Track(change.Path); err != nil {
+		return err
+	}
+
+	tmpPath, err := writeTempFile(change.Path, change.Updated, tx.originals[change.Path].mode)
+	if err != nil {
+		return err
+	}
+	tx.staged = append(tx.staged, &stagedFile{tmpPath, change.Path})
+
+	return nil
+}
+
+// Commit moves all staged files into place. It stops between files once ctx
+// is done. If it fails, some files may already have been replaced and
+// Rollback should be called.
+func (tx *Transaction) Commit(ctx context.Context) error {
+	for len(tx.staged) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s := tx.staged[0]
+		if err := os.Rename(s.tmpPath, s.path); err != nil {
+			return fmt.Errorf("failed to write %s: %s", s.path, err)
+		}
+		tx.staged = tx.staged[1:]
+		if tx.Written != nil {
+			if err := tx.Written(s.path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Rollback discards staged files that were not committed yet and restores
+// every tracked file to the state it had when it was first tracked. It tries
+// to restore all files even if some of them fail, and reports all failures.
+func (tx *Transaction) Rollback() error {
+	var errs []string
+
+	for _, s := range tx.staged {
+		if err := os.Remove(s.tmpPath); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err.Error())
+		}
+	}
+	tx.staged = nil
+
+	for _, path := range tx.order {
+		orig := tx.originals[path]
+		if !orig.existed {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err.Error())
+			}
+			continue
+		}
+		if err := WriteFileAtomic(path, orig.content, orig.mode); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to roll back %d file(s):\n%s", len(errs), strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// WriteFileAtomic writes content to a temporary file in the same directory as
+// path and renames it over path, so readers never observe a partial write.
+func WriteFileAtomic(path string, content []byte, perm os.FileMode) error {
+	tmpPath, err := writeTempFile(path, content, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// RemoveTempFiles removes the temporary files left next to path by a
+// process which died while writing it, and returns their paths.
+func RemoveTempFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		if err := os.Remove(m); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+// writeTempFile writes content to a hidden temporary file next to path, so
+// the final rename stays on the same filesystem. Hidden files are ignored by
+// the go tool should the process die before the rename.
+func writeTempFile(path string, content []byte, perm os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := f.Name()
+
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, perm)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	return tmpPath, nil
+}
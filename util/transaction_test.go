@@ -0,0 +1,130 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Transaction_commitAndRollback(t *testing.T) {
+	pluginPath := t.TempDir()
+	goMod := filepath.Join(pluginPath, "go.mod")
+	goSum := filepath.Join(pluginPath, "go.sum")
+	mustWrite(t, goMod, "module example.com/plugin\n")
+
+	tx := NewTransaction()
+	if err := tx.Track(goSum); err != nil {
+		t.Fatalf("Track: %s", err)
+	}
+	err := tx.Stage(&FileChange{
+		Path:     goMod,
+		Original: []byte("module example.com/plugin\n"),
+		Updated:  []byte("module example.com/migrated\n"),
+	})
+	if err != nil {
+		t.Fatalf("Stage: %s", err)
+	}
+
+	if got := string(mustBytes(ioutil.ReadFile(goMod))); got != "module example.com/plugin\n" {
+		t.Fatalf("expected go.mod to be untouched before commit, got %q", got)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+	if got := string(mustBytes(ioutil.ReadFile(goMod))); got != "module example.com/migrated\n" {
+		t.Fatalf("unexpected go.mod after commit: %q", got)
+	}
+
+	// simulate `go mod tidy` creating go.sum
+	mustWrite(t, goSum, "example.com/dep v1.0.0 h1:abc=\n")
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %s", err)
+	}
+	if got := string(mustBytes(ioutil.ReadFile(goMod))); got != "module example.com/plugin\n" {
+		t.Fatalf("unexpected go.mod after rollback: %q", got)
+	}
+	if _, err := os.Stat(goSum); !os.IsNotExist(err) {
+		t.Fatalf("expected go.sum to be removed, got %v", err)
+	}
+
+	entries, err := ioutil.ReadDir(pluginPath)
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only go.mod to be left, got %d entries", len(entries))
+	}
+}
+
+func Test_Transaction_rollbackStaged(t *testing.T) {
+	pluginPath := t.TempDir()
+	mainGo := filepath.Join(pluginPath, "main.go")
+	mustWrite(t, mainGo, "package main\n")
+
+	tx := NewTransaction()
+	err := tx.Stage(&FileChange{
+		Path:     mainGo,
+		Original: []byte("package main\n"),
+		Updated:  []byte("package migrated\n"),
+	})
+	if err != nil {
+		t.Fatalf("Stage: %s", err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %s", err)
+	}
+	entries, err := ioutil.ReadDir(pluginPath)
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected staged files to be removed, got %d entries", len(entries))
+	}
+	if got := string(mustBytes(ioutil.ReadFile(mainGo))); got != "package main\n" {
+		t.Fatalf("unexpected main.go after rollback: %q", got)
+	}
+}
+
+func Test_Transaction_commitCancelled(t *testing.T) {
+	pluginPath := t.TempDir()
+	mainGo := filepath.Join(pluginPath, "main.go")
+	mustWrite(t, mainGo, "package main\n")
+
+	tx := NewTransaction()
+	err := tx.Stage(&FileChange{
+		Path:     mainGo,
+		Original: []byte("package main\n"),
+		Updated:  []byte("package migrated\n"),
+	})
+	if err != nil {
+		t.Fatalf("Stage: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tx.Commit(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if got := string(mustBytes(ioutil.ReadFile(mainGo))); got != "package main\n" {
+		t.Fatalf("expected main.go to be untouched, got %q", got)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %s", err)
+	}
+	entries, err := ioutil.ReadDir(pluginPath)
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected staged files to be removed, got %d entries", len(entries))
+	}
+}
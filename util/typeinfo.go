@@ -0,0 +1,387 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+type refKind int
+
+const (
+	// refUnknown identifiers could not be resolved, so it is not known what
+	// they refer to.
+	refUnknown refKind = iota
+	// refPackage identifiers refer to the imported package being rewritten.
+	refPackage
+	// refOther identifiers refer to something else, such as a local variable
+	// shadowing the package name.
+	refOther
+)
+
+// packageRefs records what the identifiers of a single file refer to, keyed
+// by their byte offset in the file. Offsets are used rather than AST nodes so
+// type information from a separately parsed copy of the file can be used.
+type packageRefs struct {
+	// imports maps identifiers referring to an imported package to the
+	// import path of that package.
+	imports map[int]string
+	// resolved holds all identifiers that were resolved to an object, or
+	// declare one.
+	resolved map[int]bool
+	// foreign maps identifiers referring to a package-level object of
+	// another package, qualified or through a dot import, to the import
+	// path of that package. It is only filled if the imported packages were
+	// type-checked as well.
+	foreign map[int]string
+	// declared maps the names of variables, constants, types and functions
+	// declared in the file to the offset of their first declaration.
+	declared map[string]int
+	// packageNames maps the package-level identifiers of the whole package
+	// to their declaration.
+	packageNames map[string]token.Position
+	// locals holds the identifiers of the file declared in a local scope.
+	locals []*localDecl
+}
+
+// localDecl is an identifier declared in a local scope, such as a function
+// body, together with the extent of that scope.
+type localDecl struct {
+	name     string
+	position token.Position
+	// from and to are the offsets the scope spans in the file.
+	from, to int
+}
+
+func newPackageRefs() *packageRefs {
+	return &packageRefs{
+		imports:      map[int]string{},
+		resolved:     map[int]bool{},
+		foreign:      map[int]string{},
+		declared:     map[string]int{},
+		packageNames: map[string]token.Position{},
+	}
+}
+
+// kind reports whether the identifier refers to the package imported from
+// importPath.
+func (r *packageRefs) kind(fset *token.FileSet, id *ast.Ident, importPath string) refKind {
+	offset := fset.PositionFor(id.Pos(), false).Offset
+	if p, ok := r.imports[offset]; ok && p == importPath {
+		return refPackage
+	}
+	if r.resolved[offset] {
+		return refOther
+	}
+	return refUnknown
+}
+
+// conflict returns the declaration an import named name would conflict with,
+// given the offsets of the identifiers referring to the import. Package-level
+// identifiers always conflict, local ones only if their scope contains one of
+// the references.
+func (r *packageRefs) conflict(name string, uses []int) (token.Position, bool) {
+	if pos, ok := r.packageNames[name]; ok {
+		return pos, true
+	}
+	for _, l := range r.locals {
+		if l.name != name {
+			continue
+		}
+		for _, offset := range uses {
+			if l.from <= offset && offset < l.to {
+				return l.position, true
+			}
+		}
+	}
+	return token.Position{}, false
+}
+
+// collectPackageRefs records the uses and declarations of identifiers of pkg
+// in info per file.
+func collectPackageRefs(fset *token.FileSet, pkg *types.Package, info *types.Info, refs map[string]*packageRefs) {
+	files := map[string]*packageRefs{}
+	packageNames := map[string]token.Position{}
+	forFile := func(pos token.Position) *packageRefs {
+		fileRefs, ok := refs[pos.Filename]
+		if !ok {
+			fileRefs = newPackageRefs()
+			refs[pos.Filename] = fileRefs
+		}
+		files[pos.Filename] = fileRefs
+		return fileRefs
+	}
+
+	for id, obj := range info.Uses {
+		pos := fset.PositionFor(id.Pos(), false)
+		fileRefs := forFile(pos)
+		fileRefs.resolved[pos.Offset] = true
+		if pkgName, ok := obj.(*types.PkgName); ok {
+			fileRefs.imports[pos.Offset] = pkgName.Imported().Path()
+		} else if obj.Pkg() != nil && obj.Pkg() != pkg && obj.Parent() == obj.Pkg().Scope() {
+			fileRefs.foreign[pos.Offset] = obj.Pkg().Path()
+		}
+	}
+
+	for id, obj := range info.Defs {
+		pos := fset.PositionFor(id.Pos(), false)
+		fileRefs := forFile(pos)
+		// The identifier of an embedded field is a reference to its type as
+		// well, which is only resolved if it is recorded in Uses.
+		if v, ok := obj.(*types.Var); !ok || !v.Embedded() {
+			fileRefs.resolved[pos.Offset] = true
+		}
+		if obj == nil || id.Name == "_" || !declaresName(obj) {
+			continue
+		}
+		if prev, ok := fileRefs.declared[id.Name]; !ok || pos.Offset < prev {
+			fileRefs.declared[id.Name] = pos.Offset
+		}
+
+		scope := obj.Parent()
+		if scope == nil {
+			continue
+		}
+		if obj.Pkg() != nil && scope == obj.Pkg().Scope() {
+			packageNames[id.Name] = pos
+		} else if scope.Pos().IsValid() {
+			fileRefs.locals = append(fileRefs.locals, &localDecl{
+				name:     id.Name,
+				position: pos,
+				from:     fset.PositionFor(scope.Pos(), false).Offset,
+				to:       fset.PositionFor(scope.End(), false).Offset,
+			})
+		}
+	}
+
+	// Package-level identifiers conflict with imports in every file of the
+	// package.
+	for _, fileRefs := range files {
+		for name, pos := range packageNames {
+			fileRefs.packageNames[name] = pos
+		}
+	}
+}
+
+// declaresName reports whether obj is declared in a block where it can
+// conflict with an import name. Fields, methods, labels and package names are
+// excluded.
+func declaresName(obj types.Object) bool {
+	switch o := obj.(type) {
+	case *types.Var:
+		return !o.IsField()
+	case *types.Func:
+		sig, ok := o.Type().(*types.Signature)
+		return ok && sig.Recv() == nil
+	case *types.Const, *types.TypeName:
+		return true
+	}
+	return false
+}
+
+// loadPackageRefs type-checks all packages of the plugin, including tests,
+// and returns the package references of every file that could be checked,
+// keyed by absolute file path. Files missing from the result, for instance
+// because they are excluded by build constraints, have to fall back to
+// fileRefs.
+//
+// Packages and their dependencies are listed and parsed with go/packages, and
+// type-checked from source, see sourceChecker, so identifiers are resolved to
+// the objects they refer to, including those of dot imports. Packages which
+// could not be loaded, for instance because a dependency is missing from the
+// module cache, are type-checked with every import resolved to an empty
+// package instead, see stubImporter. This still resolves every
+// identifier declared in the plugin itself, which tells references to an
+// imported package apart from identifiers shadowing it.
+func loadPackageRefs(ctx context.Context, pluginPath string) map[string]*packageRefs {
+	refs := map[string]*packageRefs{}
+
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedImports | packages.NeedDeps,
+		Dir:     pluginPath,
+		Fset:    token.NewFileSet(),
+		Tests:   true,
+		Env:     os.Environ(),
+	}
+	if hasVendor, err := HasVendorFolder(pluginPath); err == nil && hasVendor {
+		cfg.BuildFlags = []string{"-mod=vendor"}
+	}
+
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		log.Printf("[WARN] Could not load packages for type information: %s", err)
+		return refs
+	}
+
+	checker := newSourceChecker(cfg.Fset, pkgs)
+	for _, pkg := range pkgs {
+		if len(pkg.Syntax) == 0 {
+			continue
+		}
+		checked := checker.check(pkg)
+		if !checked.ok {
+			for _, e := range pkg.Errors {
+				log.Printf("[DEBUG] Loading %s: %s", pkg.PkgPath, e)
+			}
+			log.Printf("[DEBUG] Type-checking %s without its dependencies", pkg.PkgPath)
+			stub, info := typeCheck(cfg.Fset, pkg.Syntax)
+			collectPackageRefs(cfg.Fset, stub, info, refs)
+			continue
+		}
+		collectPackageRefs(cfg.Fset, checked.types, checked.info, refs)
+	}
+
+	return refs
+}
+
+// sourceChecker type-checks packages loaded by go/packages from their syntax,
+// together with their dependencies. go/packages is not asked for types
+// itself, since its type-checker is not configured correctly for recent Go
+// toolchains.
+type sourceChecker struct {
+	fset  *token.FileSet
+	sizes types.Sizes
+	// roots holds the IDs of the packages of the plugin. The function
+	// bodies of other packages are not type-checked.
+	roots map[string]bool
+	// checked holds the packages type-checked so far, keyed by ID.
+	checked map[string]*checkedPackage
+}
+
+// checkedPackage is a type-checked package. ok is false if it, or one of its
+// dependencies, could not be loaded. Type errors are tolerated, since they
+// only leave the identifiers involved unresolved, e.g. a plugin may not
+// compile until code generated by go generate is updated.
+type checkedPackage struct {
+	types *types.Package
+	info  *types.Info
+	ok    bool
+}
+
+func newSourceChecker(fset *token.FileSet, roots []*packages.Package) *sourceChecker {
+	c := &sourceChecker{
+		fset:    fset,
+		sizes:   types.SizesFor(build.Default.Compiler, build.Default.GOARCH),
+		roots:   map[string]bool{},
+		checked: map[string]*checkedPackage{},
+	}
+	for _, pkg := range roots {
+		c.roots[pkg.ID] = true
+	}
+	return c
+}
+
+func (c *sourceChecker) check(pkg *packages.Package) *checkedPackage {
+	if checked, ok := c.checked[pkg.ID]; ok {
+		return checked
+	}
+	checked := &checkedPackage{ok: len(pkg.Errors) == 0}
+	c.checked[pkg.ID] = checked
+
+	conf := &types.Config{
+		Importer: importerFunc(func(importPath string) (*types.Package, error) {
+			if importPath == "unsafe" {
+				return types.Unsafe, nil
+			}
+			imp, ok := pkg.Imports[importPath]
+			if !ok {
+				return nil, fmt.Errorf("no metadata for %s", importPath)
+			}
+			dep := c.check(imp)
+			if dep.types == nil {
+				return nil, fmt.Errorf("import cycle through %s", importPath)
+			}
+			checked.ok = checked.ok && dep.ok
+			return dep.types, nil
+		}),
+		IgnoreFuncBodies: !c.roots[pkg.ID],
+		Sizes:            c.sizes,
+		Error:            func(error) {},
+	}
+	checked.info = &types.Info{
+		Defs: map[*ast.Ident]types.Object{},
+		Uses: map[*ast.Ident]types.Object{},
+	}
+	checked.types, _ = conf.Check(pkg.PkgPath, c.fset, pkg.Syntax, checked.info)
+	return checked
+}
+
+type importerFunc func(importPath string) (*types.Package, error)
+
+func (f importerFunc) Import(importPath string) (*types.Package, error) {
+	return f(importPath)
+}
+
+// fileRefs type-checks a single file on its own, with every import resolved
+// to an empty package. This is enough to tell package names apart from local
+// identifiers shadowing them, but any identifier declared in another file of
+// the package remains unresolved.
+func fileRefs(fset *token.FileSet, f *ast.File) *packageRefs {
+	refs := map[string]*packageRefs{}
+	pkg, info := typeCheck(fset, []*ast.File{f})
+	collectPackageRefs(fset, pkg, info, refs)
+	if r, ok := refs[fset.PositionFor(f.Pos(), false).Filename]; ok {
+		return r
+	}
+	return newPackageRefs()
+}
+
+// typeCheck type-checks the files of a single package against stubImporter
+// and returns the package with the resolved uses and declarations of
+// identifiers.
+func typeCheck(fset *token.FileSet, files []*ast.File) (*types.Package, *types.Info) {
+	conf := &types.Config{
+		Importer: stubImporter{},
+		// Errors are expected, since imported packages are empty.
+		Error: func(error) {},
+	}
+	info := &types.Info{
+		Defs: map[*ast.Ident]types.Object{},
+		Uses: map[*ast.Ident]types.Object{},
+	}
+	pkg, _ := conf.Check(files[0].Name.Name, fset, files, info)
+	return pkg, info
+}
+
+// stubImporter resolves every import to an empty package. The name of the
+// package is guessed from its import path, so unnamed imports of packages
+// whose name differs from their path stay unresolved.
+type stubImporter struct{}
+
+func (stubImporter) Import(importPath string) (*types.Package, error) {
+	pkg := types.NewPackage(importPath, guessPackageName(importPath))
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// guessPackageName guesses the name of a package from its import path,
+// skipping major version suffixes and turning dashes into underscores.
+func guessPackageName(importPath string) string {
+	name := path.Base(importPath)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = path.Base(path.Dir(importPath))
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
@@ -4,30 +4,24 @@
 package util
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"go/ast"
 	"go/parser"
-	"go/printer"
 	"go/token"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
 	"golang.org/x/mod/modfile"
-	"golang.org/x/tools/go/ast/astutil"
 )
 
-var printConfig = printer.Config{
-	Mode:     printer.TabIndent | printer.UseSpaces,
-	Tabwidth: 8,
-}
-
 func StringSliceContains(ss []string, s string) bool {
 	for _, i := range ss {
 		if i == s {
@@ -98,37 +92,59 @@ func GetpluginPath(pluginRepoName string) (string, error) {
 }
 
 func RewriteGoMod(pluginPath string, sdkVersion string, oldPackagePath string, newPackagePath string) error {
+	change, err := GoModChange(pluginPath, sdkVersion, oldPackagePath, newPackagePath)
+	if err != nil {
+		return err
+	}
+
+	return change.Write()
+}
+
+// GoModChange computes the rewritten go.mod file of the plugin without
+// writing it.
+func GoModChange(pluginPath string, sdkVersion string, oldPackagePath string, newPackagePath string) (*FileChange, error) {
 	goModPath := filepath.Join(pluginPath, "go.mod")
 
 	input, err := ioutil.ReadFile(goModPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	pf, err := modfile.Parse(goModPath, input, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = pf.DropRequire(oldPackagePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	pf.AddNewRequire(newPackagePath, sdkVersion, false)
+	// A partially migrated plugin keeps the version it requires already.
+	if !requires(pf, newPackagePath) {
+		pf.AddNewRequire(newPackagePath, sdkVersion, false)
+	}
 
 	pf.Cleanup()
 	formattedOutput, err := pf.Format()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ioutil.WriteFile(goModPath, formattedOutput, 0644)
-	if err != nil {
-		return err
-	}
+	return &FileChange{
+		Path:     goModPath,
+		Original: input,
+		Updated:  formattedOutput,
+	}, nil
+}
 
-	return nil
+func requires(f *modfile.File, path string) bool {
+	for _, r := range f.Require {
+		if r.Mod.Path == path {
+			return true
+		}
+	}
+	return false
 }
 
 type visitFn func(node ast.Node)
@@ -138,156 +154,228 @@ func (fn visitFn) Visit(node ast.Node) ast.Visitor {
 	return fn
 }
 
-func RewriteImportedPackageImports(filePath string) error {
-	if _, err := os.Stat(filePath); err != nil {
-		return err
-	}
-
-	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments)
+// RewriteImportedPackageImports rewrites the imports of the Go file at
+// filePath in place. opts may be nil.
+func RewriteImportedPackageImports(filePath string, rules *Rules, opts *ImportsOptions) error {
+	change, err := ImportsChange(filePath, rules, opts)
 	if err != nil {
 		return err
 	}
 
-	addImports := map[string]string{}
-	deleteImports := map[string]string{}
+	return change.Write()
+}
 
-	for _, impSpec := range f.Imports {
-		impPath, err := strconv.Unquote(impSpec.Path.Value)
+// PluginImportsChanges computes the rewritten imports of every Go file in the
+// plugin, except those in vendor/ and the migrator's own state directory,
+// without writing them. Only files whose content changes are returned.
+//
+// The plugin is type-checked first, so that only references to the imported
+// packages are rewritten and identifiers shadowing a package name are left
+// alone.
+func PluginImportsChanges(ctx context.Context, pluginPath string, rules *Rules, opts *ImportsOptions) ([]*FileChange, error) {
+	refs := loadPackageRefs(ctx, pluginPath)
+
+	changes := []*FileChange{}
+	err := filepath.Walk(pluginPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			log.Print(err)
+			return err
 		}
-		if newImpPath, ok := ONE_TO_ONE_REPLACEMENTS[impPath]; ok {
-			log.Printf("Changing import of %s to %s", impPath, newImpPath)
-			impSpec.Path.Value = strconv.Quote(newImpPath)
-		} else if newImpPath, ok := PACKAGE_RENAME[impPath]; ok {
-			// fix imports
-			log.Printf("Changing import of %s to %s", impPath, newImpPath)
-			impSpec.Path.Value = strconv.Quote(newImpPath)
-
-			// fix package name in expressions that reference this package
-			pathparts := strings.Split(newImpPath, "/")
-			newImpName := pathparts[len(pathparts)-1]
-
-			name := impSpec.Name
-			oldNameString := ""
-			if name != nil {
-				oldNameString = name.String()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == "vendor" || info.Name() == StateDir) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".go") {
+			change, err := importsChange(path, rules, refs[absPath(path)], opts)
+			if err != nil {
+				return err
 			}
-
-			if oldNameString == "" {
-				pathparts := strings.Split(impPath, "/")
-				oldNameString = pathparts[len(pathparts)-1]
+			if change.Changed() {
+				changes = append(changes, change)
 			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-			ast.Walk(visitFn(func(n ast.Node) {
-				sel, ok := n.(*ast.SelectorExpr)
-				if ok {
-					id, ok := sel.X.(*ast.Ident)
-					if ok {
-						if id.Name == oldNameString {
-							id.Name = newImpName
-							log.Printf("renamed %s to %s", oldNameString, newImpName)
-						}
-					}
-				}
-			}), f)
-		} else if _, ok := PACKAGE_SPLIT[impPath]; ok {
-			log.Printf("Package %s has been refactored into multiple new SDK"+
-				"packages; walking the ast to update each object as required.", impPath)
-			// We store the package split map with the old import path as the
-			// original key so we can find the moved items easily; now we need
-			// to remap it so we can iterate over object names instead to figure
-			// out where they should end up.
-			remap := map[string]map[string]string{}
-
-			for newImportPath, structList := range PACKAGE_SPLIT[impPath] {
-				for _, val := range structList {
-					remap[val] = map[string]string{impPath: newImportPath}
-				}
-			}
+	return changes, nil
+}
 
-			// fix package name in expressions that reference this package
-			name := impSpec.Name
-			oldNameString := ""
-			if name != nil {
-				oldNameString = name.String()
-			}
+// ImportsChange computes the rewritten content of the Go file at filePath
+// without writing it. The file is type-checked on its own, see
+// PluginImportsChanges to use the type information of the whole plugin. opts
+// may be nil.
+func ImportsChange(filePath string, rules *Rules, opts *ImportsOptions) (*FileChange, error) {
+	return importsChange(filePath, rules, nil, opts)
+}
 
-			if oldNameString == "" {
-				pathparts := strings.Split(impPath, "/")
-				oldNameString = pathparts[len(pathparts)-1]
-			}
+func importsChange(filePath string, rules *Rules, refs *packageRefs, opts *ImportsOptions) (*FileChange, error) {
+	if opts == nil {
+		opts = &ImportsOptions{}
+	}
 
-			ast.Walk(visitFn(func(n ast.Node) {
-				sel, ok := n.(*ast.SelectorExpr)
-				if ok {
-					if id, ok := sel.X.(*ast.Ident); ok {
-						if id.Name == oldNameString {
-							// look up correct new import path in map, rename
-							// it in this object, and add it to the imports.
-							newImpPath := remap[sel.Sel.Name][impPath]
-							// newImpPath := impList[impPath]
-							pathparts := strings.Split(newImpPath, "/")
-							newImpName := pathparts[len(pathparts)-1]
-							// if we were importing with a custom name, retain
-							// that customization and append new path name.
-							if impSpec.Name != nil {
-								newImpName = oldNameString + "_" + newImpName
-							}
-							id.Name = newImpName
-							// Instead of copying import spec, create entirely
-							// new one.
-							if impSpec.Name == nil {
-								addImports[newImpPath] = ""
-								deleteImports[impPath] = ""
-							}
-							addImports[newImpPath] = newImpName
-							deleteImports[impPath] = oldNameString
-
-						}
-					}
-				}
-			}), f)
+	src, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return rewriteImports(filePath, src, rules, refs, opts)
+}
+
+// rewriteImports rewrites the imports of the file and the references to the
+// imported packages. Selectors are only rewritten if refs resolves them to
+// the imported package; selectors that cannot be resolved but look like a
+// reference to it are left untouched and listed in the change. If refs is
+// nil, the file is type-checked on its own.
+func rewriteImports(filePath string, src []byte, rules *Rules, refs *packageRefs, opts *ImportsOptions) (*FileChange, error) {
+	r, err := newImportRewriter(filePath, src, rules, refs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Annotations are collected before any import is rewritten, while the
+	// import paths still refer to the Packer core packages.
+	var notes []*annotation
+	if opts.Annotate {
+		notes = append(removedPackageNotes(r.f, rules), deprecationNotes(r.fset, r.f, rules, r.refs)...)
+	}
+
+	for _, impSpec := range r.f.Imports {
+		r.rewriteImport(impSpec)
+	}
+	if r.aliasErr != nil {
+		return nil, r.aliasErr
+	}
+
+	taken, untouched := r.untouchedImports()
+	r.reuseImports(untouched)
+	aliases := resolveCollisions(r.fset, r.refs, r.newImports, taken, opts.AliasPolicy)
+
+	edits := r.identifierEdits()
+	importEdits, touched := r.importEdits()
+	edits = append(append(r.edits, edits...), importEdits...)
+
+	annotations := 0
+	if opts.Annotate {
+		annotationEdits := r.annotationEdits(notes)
+		annotations = len(annotationEdits)
+		edits = append(edits, annotationEdits...)
+	}
+
+	// Groups of imports holding a new import path are sorted again, as
+	// gofmt would.
+	updated := src
+	if len(edits) > 0 {
+		updated, err = applyEdits(src, edits)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filePath, err)
+		}
+		updated, err = sortImportGroups(filePath, updated, touched)
+		if err != nil {
+			return nil, err
+		}
+		if opts.LocalPrefix != "" {
+			updated, err = groupImports(filePath, updated, opts.LocalPrefix)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	// Cannot add or delete imports to the imports list while looping over the
-	// list or we'll get some gross side effeects and miss imports altogether.
-	// Instead, loop over our dictionaries after the fact to add and delete
-	// the necessary imports only once per import path.
-	for impPath, impName := range addImports {
-		astutil.AddNamedImport(fset, f, impName, impPath)
+	return &FileChange{
+		Path:        filePath,
+		Original:    src,
+		Updated:     updated,
+		Skipped:     r.skipped,
+		Annotations: annotations,
+		Aliases:     aliases,
+		Rewrites:    rewriteLines(filePath, updated, r.newImports),
+	}, nil
+}
+
+// rewriteLines returns the lines of the rewritten file holding the new
+// imports, or a selector of the name they are imported as.
+func rewriteLines(filePath string, src []byte, imports []*newImport) []*Rewrite {
+	if len(imports) == 0 {
+		return nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filePath, src, 0)
+	if err != nil {
+		log.Printf("[DEBUG] cannot parse rewritten file %s: %s", filePath, err)
+		return nil
 	}
-	for impPath, impName := range deleteImports {
-		deleted := astutil.DeleteNamedImport(fset, f, impName, impPath)
-		if !deleted {
-			log.Printf("issue deleting import %s; may need to manually delete", impPath)
+
+	// byPath and byName map the imports to the mapping rules they come
+	// from.
+	byPath, byName := map[string]*Rewrite{}, map[string]*Rewrite{}
+	for _, imp := range imports {
+		from, _ := strconv.Unquote(imp.replaced.Path.Value)
+		r := &Rewrite{From: from, To: imp.path}
+		byPath[imp.path] = r
+		if imp.name != "." && imp.name != "_" {
+			byName[imp.name] = r
 		}
+	}
 
+	rewrites := []*Rewrite{}
+	seen := map[Rewrite]bool{}
+	add := func(pos token.Pos, r *Rewrite) {
+		line := *r
+		line.Line = fset.Position(pos).Line
+		if !seen[line] {
+			seen[line] = true
+			rewrites = append(rewrites, &line)
+		}
 	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ImportSpec:
+			path, _ := strconv.Unquote(n.Path.Value)
+			if r, ok := byPath[path]; ok {
+				add(n.Pos(), r)
+			}
+		case *ast.SelectorExpr:
+			if id, ok := n.X.(*ast.Ident); ok {
+				if r, ok := byName[id.Name]; ok {
+					add(id.Pos(), r)
+				}
+			}
+		}
+		return true
+	})
+	sort.SliceStable(rewrites, func(i, j int) bool {
+		return rewrites[i].Line < rewrites[j].Line
+	})
+	return rewrites
+}
 
-	// overwrite imports
-	ast.SortImports(fset, f)
-	out, err := os.Create(filePath)
+// HasVendorFolder reports whether the plugin vendors its dependencies.
+func HasVendorFolder(pluginPath string) (bool, error) {
+	vendorPath := filepath.Join(pluginPath, "vendor")
+	fs, err := os.Stat(vendorPath)
 	if err != nil {
-		return err
-	}
-	defer out.Close()
-	w := bufio.NewWriter(out)
-	if err := printConfig.Fprint(w, fset, f); err != nil {
-		return err
+		if os.IsNotExist(err) {
+			return false, nil
+		} else {
+			return false, err
+		}
 	}
-	if err := w.Flush(); err != nil {
-		return err
+	if !fs.Mode().IsDir() {
+		return false, fmt.Errorf("%s is not folder (expected folder)", vendorPath)
 	}
 
-	return nil
+	return true, nil
 }
 
-func GoModTidy(pluginPath string) error {
+// GoModTidy runs `go mod tidy` in the plugin directory. The command is killed
+// if ctx is done, in which case the error of ctx is returned.
+func GoModTidy(ctx context.Context, pluginPath string) error {
 	args := []string{"go", "mod", "tidy"}
-	cmd := exec.Command(args[0], args[1:]...)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
 	cmd.Env = os.Environ()
 	cmd.Dir = pluginPath
 
@@ -297,6 +385,9 @@ func GoModTidy(pluginPath string) error {
 
 	log.Printf("[DEBUG] Executing command %q", args)
 	err := cmd.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if err != nil {
 		return NewExecError(err, stderr.String())
 	}
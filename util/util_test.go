@@ -4,6 +4,8 @@
 package util
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -12,6 +14,16 @@ import (
 	"github.com/google/go-cmp/cmp"
 )
 
+// testRules returns the built-in rules for the default SDK version.
+func testRules(t *testing.T) *Rules {
+	t.Helper()
+	rules, err := DefaultRules().ForVersion(DefaultSDKVersion)
+	if err != nil {
+		t.Fatalf("ForVersion: %s", err)
+	}
+	return rules
+}
+
 func testFixture(n ...string) string {
 	paths := []string{"test-fixtures"}
 	paths = append(paths, n...)
@@ -41,6 +53,10 @@ func Test_sdk_migrate(t *testing.T) {
 		folder string
 	}{
 		{"sdk_migrate_basic"},
+		{"sdk_migrate_shadowed"},
+		{"sdk_migrate_unmapped"},
+		{"sdk_migrate_dot"},
+		{"sdk_migrate_format"},
 	}
 
 	for _, tc := range tc {
@@ -50,7 +66,8 @@ func Test_sdk_migrate(t *testing.T) {
 			CopyInputFile(t, inputPath, outputPath)
 
 			expectedPath := filepath.Join(testFixture(tc.folder, "expected.go.txt"))
-			RewriteImportedPackageImports(outputPath)
+			rules := testRules(t)
+			RewriteImportedPackageImports(outputPath, rules, nil)
 
 			expected := mustBytes(ioutil.ReadFile(expectedPath))
 			actual := mustBytes(ioutil.ReadFile(outputPath))
@@ -63,6 +80,378 @@ func Test_sdk_migrate(t *testing.T) {
 	}
 }
 
+func Test_rewriteImports_unresolved(t *testing.T) {
+	rules := testRules(t)
+	src := mustBytes(ioutil.ReadFile(testFixture("sdk_migrate_shadowed", "input.go.txt")))
+
+	// Without any type information, no selector can be told apart from a
+	// reference to the package, so all of them are left untouched.
+	change, err := rewriteImports("input.go", src, rules, newPackageRefs(), &ImportsOptions{})
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+
+	actual := []string{}
+	for _, s := range change.Skipped {
+		actual = append(actual, fmt.Sprintf("%d:%d %s", s.Position.Line, s.Position.Column, s.Expr))
+	}
+	expected := []string{
+		"11:2 common.StepDownload",
+		"22:9 common.Name",
+		"15:28 provisioner.GuestCommands",
+		"16:38 provisioner.GuestOSType",
+		"16:63 provisioner.Sudo",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("unexpected skipped references: %s", diff)
+	}
+}
+
+func Test_rewriteImports_unmapped(t *testing.T) {
+	rules := testRules(t)
+	src := mustBytes(ioutil.ReadFile(testFixture("sdk_migrate_unmapped", "input.go.txt")))
+
+	change, err := rewriteImports("input.go", src, rules, nil, &ImportsOptions{})
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+
+	actual := []string{}
+	for _, s := range change.Skipped {
+		actual = append(actual, s.String())
+	}
+	expected := []string{
+		"input.go:15:9: common.Retry: Retry is not mapped to any SDK package; import of github.com/hashicorp/packer/common retained",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("unexpected skipped references: %s", diff)
+	}
+}
+
+func Test_ImportsChange_annotate(t *testing.T) {
+	rules := testRules(t)
+	inputPath := testFixture("sdk_migrate_annotate", "input.go.txt")
+	expectedPath := testFixture("sdk_migrate_annotate", "expected.go.txt")
+
+	change, err := ImportsChange(inputPath, rules, &ImportsOptions{Annotate: true})
+	if err != nil {
+		t.Fatalf("ImportsChange: %s", err)
+	}
+	if change.Annotations != 2 {
+		t.Fatalf("expected 2 annotations, got %d", change.Annotations)
+	}
+	expected := mustBytes(ioutil.ReadFile(expectedPath))
+	if diff := cmp.Diff(string(expected), string(change.Updated)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+
+	// Annotating an annotated file again does not duplicate the comments.
+	change, err = rewriteImports(inputPath, change.Updated, rules, nil, &ImportsOptions{Annotate: true})
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+	if change.Annotations != 0 {
+		t.Fatalf("expected no annotations on the second run, got %d", change.Annotations)
+	}
+}
+
+func Test_rewriteImports_aliasPolicy(t *testing.T) {
+	rules := testRules(t)
+	inputPath := testFixture("sdk_migrate_alias", "input.go.txt")
+	src := mustBytes(ioutil.ReadFile(inputPath))
+
+	for _, policy := range []AliasPolicy{AliasDefault, AliasTable, AliasCamelCase} {
+		t.Run(policy.String(), func(t *testing.T) {
+			expectedPath := testFixture("sdk_migrate_alias", "expected_"+policy.String()+".go.txt")
+			change, err := rewriteImports(inputPath, src, rules, nil, &ImportsOptions{AliasPolicy: policy})
+			if err != nil {
+				t.Fatalf("rewriteImports: %s", err)
+			}
+			expected := mustBytes(ioutil.ReadFile(expectedPath))
+			if diff := cmp.Diff(string(expected), string(change.Updated)); diff != "" {
+				t.Fatalf("unexpected output: %s", diff)
+			}
+		})
+	}
+}
+
+func Test_rewriteImports_aliasConflict(t *testing.T) {
+	rules := testRules(t)
+	src := []byte(`package main
+
+import "github.com/hashicorp/packer/packer"
+
+var packersdk packer.Ui
+`)
+
+	_, err := rewriteImports("input.go", src, rules, nil, &ImportsOptions{AliasPolicy: AliasTable})
+	conflict, ok := err.(*AliasConflictError)
+	if !ok {
+		t.Fatalf("expected *AliasConflictError, got %v", err)
+	}
+	if conflict.Alias != "packersdk" || conflict.Position.String() != "input.go:5:5" {
+		t.Fatalf("unexpected conflict: %s", conflict)
+	}
+}
+
+func Test_rewriteImports_collisions(t *testing.T) {
+	rules := testRules(t)
+	inputPath := testFixture("sdk_migrate_collision", "input.go.txt")
+	expectedPath := testFixture("sdk_migrate_collision", "expected.go.txt")
+	src := mustBytes(ioutil.ReadFile(inputPath))
+
+	change, err := rewriteImports("input.go", src, rules, nil, &ImportsOptions{})
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+	expected := mustBytes(ioutil.ReadFile(expectedPath))
+	if diff := cmp.Diff(string(expected), string(change.Updated)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+
+	actual := []string{}
+	for _, a := range change.Aliases {
+		actual = append(actual, a.String())
+	}
+	expectedAliases := []string{
+		"input.go:4:2: imported github.com/hashicorp/packer-plugin-sdk/common as sdkcommon, since common is already the name of the import of github.com/hashicorp/packer/common",
+		"input.go:4:2: imported github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps as sdkcommonsteps, since commonsteps is declared at input.go:17:2",
+		"input.go:5:2: imported github.com/hashicorp/packer-plugin-sdk/guestexec as sdkguestexec, since guestexec is declared at input.go:9:5",
+	}
+	if diff := cmp.Diff(expectedAliases, actual); diff != "" {
+		t.Fatalf("unexpected aliases: %s", diff)
+	}
+}
+
+func Test_PluginImportsChanges_packageScope(t *testing.T) {
+	dir := t.TempDir()
+	mustWrite(t, filepath.Join(dir, "go.mod"), "module example.com/plugin\n\ngo 1.16\n")
+	mustWrite(t, filepath.Join(dir, "a.go"), `package plugin
+
+import "github.com/hashicorp/packer/provisioner"
+
+var _ = provisioner.GuestOSType("")
+`)
+	mustWrite(t, filepath.Join(dir, "b.go"), `package plugin
+
+var guestexec = 1
+`)
+
+	changes, err := PluginImportsChanges(context.Background(), dir, testRules(t), &ImportsOptions{})
+	if err != nil {
+		t.Fatalf("PluginImportsChanges: %s", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes))
+	}
+	expected := `package plugin
+
+import sdkguestexec "github.com/hashicorp/packer-plugin-sdk/guestexec"
+
+var _ = sdkguestexec.GuestOSType("")
+`
+	if diff := cmp.Diff(expected, string(changes[0].Updated)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+
+	actual := []string{}
+	for _, a := range changes[0].Aliases {
+		actual = append(actual, a.String())
+	}
+	expectedAliases := []string{
+		fmt.Sprintf("%s:3:8: imported github.com/hashicorp/packer-plugin-sdk/guestexec as sdkguestexec, since guestexec is declared at %s:3:5",
+			filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")),
+	}
+	if diff := cmp.Diff(expectedAliases, actual); diff != "" {
+		t.Fatalf("unexpected aliases: %s", diff)
+	}
+}
+
+func Test_PluginImportsChanges_dotImports(t *testing.T) {
+	// The Packer core packages are replaced by a local copy, so that the
+	// plugin can be type-checked together with its dependencies.
+	dir := t.TempDir()
+	mustWrite(t, filepath.Join(dir, "go.mod"), `module example.com/plugin
+
+go 1.16
+
+require github.com/hashicorp/packer v1.6.5
+
+replace github.com/hashicorp/packer => ./packer
+`)
+	mustWrite(t, filepath.Join(dir, "packer", "go.mod"), "module github.com/hashicorp/packer\n\ngo 1.16\n")
+	mustWrite(t, filepath.Join(dir, "packer", "hcl2template", "types.go"), "package hcl2template\n\ntype KeyValue struct{}\n")
+	mustWrite(t, filepath.Join(dir, "helpers", "helpers.go"), "package helpers\n\ntype MockConfig struct{}\n")
+	mustWrite(t, filepath.Join(dir, "main.go"), `package main
+
+import (
+	. "example.com/plugin/helpers"
+	. "github.com/hashicorp/packer/hcl2template"
+)
+
+var _ KeyValue
+
+// MockConfig is moved to hcl2helper, but this one is declared in helpers.
+var _ MockConfig
+
+func main() {}
+`)
+
+	changes, err := PluginImportsChanges(context.Background(), dir, testRules(t), &ImportsOptions{})
+	if err != nil {
+		t.Fatalf("PluginImportsChanges: %s", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes))
+	}
+	expected := `package main
+
+import (
+	. "example.com/plugin/helpers"
+	. "github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+var _ KeyValue
+
+// MockConfig is moved to hcl2helper, but this one is declared in helpers.
+var _ MockConfig
+
+func main() {}
+`
+	if diff := cmp.Diff(expected, string(changes[0].Updated)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+}
+
+func Test_applyEdits_overlapping(t *testing.T) {
+	src := []byte("package example\n")
+	_, err := applyEdits(src, []*edit{{0, 7, "package"}, {4, 10, "x"}})
+	if err == nil {
+		t.Fatal("expected an error for overlapping edits")
+	}
+	expected := "overlapping edits at offsets 0-7 and 4-10"
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+}
+
+func Test_rewriteImports_partiallyMigrated(t *testing.T) {
+	rules := testRules(t)
+	src := []byte(`package example
+
+import (
+	ge "github.com/hashicorp/packer-plugin-sdk/guestexec"
+	"github.com/hashicorp/packer/provisioner"
+)
+
+var _ = ge.GuestOSType("")
+var _ = provisioner.GuestOSType("")
+`)
+	expected := `package example
+
+import (
+	ge "github.com/hashicorp/packer-plugin-sdk/guestexec"
+)
+
+var _ = ge.GuestOSType("")
+var _ = ge.GuestOSType("")
+`
+
+	change, err := rewriteImports("input.go", src, rules, nil, &ImportsOptions{})
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+	if diff := cmp.Diff(expected, string(change.Updated)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+	if len(change.Aliases) != 0 {
+		t.Fatalf("unexpected aliases: %v", change.Aliases)
+	}
+}
+
+func Test_rewriteImports_localPrefix(t *testing.T) {
+	rules := testRules(t)
+	inputPath := testFixture("sdk_migrate_local", "input.go.txt")
+	expectedPath := testFixture("sdk_migrate_local", "expected.go.txt")
+	src := mustBytes(ioutil.ReadFile(inputPath))
+	opts := &ImportsOptions{LocalPrefix: "github.com/ourorg/"}
+
+	change, err := rewriteImports(inputPath, src, rules, nil, opts)
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+	expected := mustBytes(ioutil.ReadFile(expectedPath))
+	if diff := cmp.Diff(string(expected), string(change.Updated)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+
+	// Files without anything to migrate are not formatted.
+	src = []byte("package example\n\nimport (\n\t\"github.com/ourorg/x\"\n\t\"fmt\"\n)\n\nvar  _ = fmt.Sprint(x.X)\n")
+	change, err = rewriteImports(inputPath, src, rules, nil, opts)
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+	if change.Changed() {
+		t.Fatalf("unexpected change:\n%s", change.Updated)
+	}
+}
+
+func Test_rewriteImports_blankSplit(t *testing.T) {
+	rules := testRules(t)
+	src := []byte(`package main
+
+import _ "github.com/hashicorp/packer/common"
+`)
+
+	change, err := rewriteImports("input.go", src, rules, nil, &ImportsOptions{})
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+	expected := `package main
+
+import (
+	_ "github.com/hashicorp/packer-plugin-sdk/common"
+	_ "github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+)
+`
+	if diff := cmp.Diff(expected, string(change.Updated)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+}
+
+func Test_rewriteImports_dotUnmapped(t *testing.T) {
+	rules := testRules(t)
+	src := []byte(`package main
+
+import . "github.com/hashicorp/packer/common"
+
+var _ = StepDownload{}
+var _ = Retry
+`)
+
+	change, err := rewriteImports("input.go", src, rules, nil, &ImportsOptions{})
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+	expected := `package main
+
+import (
+	. "github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	. "github.com/hashicorp/packer/common"
+)
+
+var _ = StepDownload{}
+var _ = Retry
+`
+	if diff := cmp.Diff(expected, string(change.Updated)); diff != "" {
+		t.Fatalf("unexpected output: %s", diff)
+	}
+	if len(change.Skipped) != 1 || change.Skipped[0].String() !=
+		"input.go:6:9: Retry: could not map Retry to any SDK package; dot import of github.com/hashicorp/packer/common retained" {
+		t.Fatalf("unexpected skipped references: %v", change.Skipped)
+	}
+}
+
 func mustBytes(b []byte, e error) []byte {
 	if e != nil {
 		panic(e)
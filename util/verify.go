@@ -0,0 +1,133 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/token"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// verifyCommands are run by Verify, in order. Tests are compiled but not run.
+var verifyCommands = [][]string{
+	{"go", "build", "./..."},
+	{"go", "vet", "./..."},
+	{"go", "test", "-run", "^$", "./..."},
+}
+
+// VerifyStep is the result of one of the commands run by Verify.
+type VerifyStep struct {
+	Command string
+	// Err is nil if the command succeeded.
+	Err error
+	// Errors lists the compiler errors reported by the command, except those
+	// already reported by an earlier step.
+	Errors []*CompileError
+}
+
+// Passed reports whether the command succeeded.
+func (vs *VerifyStep) Passed() bool {
+	return vs.Err == nil
+}
+
+// CompileError is an error reported by the Go toolchain at a position in the
+// plugin.
+type CompileError struct {
+	Position token.Position
+	Message  string
+	// Rewrites lists the mapping rules which rewrote the line of the error.
+	// It is empty if the line was not touched by the migration.
+	Rewrites []*Rewrite
+}
+
+func (ce *CompileError) String() string {
+	return fmt.Sprintf("%s: %s", ce.Position, ce.Message)
+}
+
+// compileErrorRE matches the errors printed by go build, go vet and go test,
+// e.g. "./main.go:12:2: undefined: packer.Foo" or "vet: main.go:3:8: ...".
+var compileErrorRE = regexp.MustCompile(`^(?:vet: )?(\S+\.go):(\d+)(?::(\d+))?: (.+)$`)
+
+// Verify builds, vets and compiles the tests of the plugin, and maps the
+// compiler errors back to the mapping rules which rewrote the erroneous lines,
+// using the given changes. Every command is run, even if an earlier one
+// failed. An error is only returned if a command cannot be run at all, or if
+// ctx is done, in which case the running command is killed.
+func Verify(ctx context.Context, pluginPath string, changes []*FileChange) ([]*VerifyStep, error) {
+	byPath := map[string]*FileChange{}
+	for _, change := range changes {
+		byPath[absPath(change.Path)] = change
+	}
+
+	steps := []*VerifyStep{}
+	reported := map[string]bool{}
+	for _, args := range verifyCommands {
+		step := &VerifyStep{Command: strings.Join(args, " ")}
+		steps = append(steps, step)
+
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Env = os.Environ()
+		cmd.Dir = pluginPath
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+
+		log.Printf("[DEBUG] Executing command %q", args)
+		err := cmd.Run()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, err
+		}
+		step.Err = NewExecError(err, output.String())
+
+		for _, ce := range parseCompileErrors(pluginPath, output.String()) {
+			key := ce.String()
+			if reported[key] {
+				continue
+			}
+			reported[key] = true
+			if change, ok := byPath[ce.Position.Filename]; ok {
+				ce.Rewrites = change.RewritesAt(ce.Position.Line)
+			}
+			step.Errors = append(step.Errors, ce)
+		}
+	}
+	return steps, nil
+}
+
+// parseCompileErrors returns the errors found in the output of a go command
+// run in dir, with absolute file names.
+func parseCompileErrors(dir, output string) []*CompileError {
+	errors := []*CompileError{}
+	for _, line := range strings.Split(output, "\n") {
+		m := compileErrorRE.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		filename := m[1]
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filename)
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		errors = append(errors, &CompileError{
+			Position: token.Position{Filename: absPath(filename), Line: lineNo, Column: column},
+			Message:  m[4],
+		})
+	}
+	return errors
+}
@@ -0,0 +1,120 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_parseCompileErrors(t *testing.T) {
+	dir := filepath.FromSlash("/plugin")
+	output := `# example.com/plugin
+./main.go:12:2: undefined: packer.Foo
+vet: builder/config.go:3:8: could not import github.com/hashicorp/packer-plugin-sdk/shell-local/config.go
+go: downloading github.com/hashicorp/hcl/v2 v2.6.0
+FAIL	example.com/plugin [build failed]
+`
+	actual := []string{}
+	for _, ce := range parseCompileErrors(dir, output) {
+		actual = append(actual, ce.String())
+	}
+	expected := []string{
+		filepath.Join(dir, "main.go") + ":12:2: undefined: packer.Foo",
+		filepath.Join(dir, "builder", "config.go") + ":3:8: could not import github.com/hashicorp/packer-plugin-sdk/shell-local/config.go",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("unexpected errors: %s", diff)
+	}
+}
+
+func Test_rewriteImports_rewrites(t *testing.T) {
+	rules := testRules(t)
+	src := []byte(`package main
+
+import (
+	"github.com/hashicorp/packer/common"
+	"github.com/hashicorp/packer/packer"
+)
+
+type Config struct {
+	common.PackerConfig
+	common.FloppyConfig
+}
+
+var _ packer.Ui
+`)
+
+	change, err := rewriteImports("input.go", src, rules, nil, &ImportsOptions{})
+	if err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+	actual := []string{}
+	for _, r := range change.Rewrites {
+		actual = append(actual, fmt.Sprintf("%d: %s", r.Line, r))
+	}
+	expected := []string{
+		"4: github.com/hashicorp/packer/common -> github.com/hashicorp/packer-plugin-sdk/common",
+		"5: github.com/hashicorp/packer/common -> github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps",
+		"6: github.com/hashicorp/packer/packer -> github.com/hashicorp/packer-plugin-sdk/packer",
+		"10: github.com/hashicorp/packer/common -> github.com/hashicorp/packer-plugin-sdk/common",
+		"11: github.com/hashicorp/packer/common -> github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps",
+		"14: github.com/hashicorp/packer/packer -> github.com/hashicorp/packer-plugin-sdk/packer",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("unexpected rewrites: %s\n%s", diff, change.Updated)
+	}
+}
+
+func Test_Verify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer-sdk-migrator-verify")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod":  "module example.com/plugin\n\ngo 1.16\n",
+		"main.go": "package main\n\nfunc main() {\n\tundefinedFunc()\n\tundefinedVar++\n}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	changes := []*FileChange{{
+		Path:     filepath.Join(dir, "main.go"),
+		Rewrites: []*Rewrite{{Line: 5, From: "github.com/hashicorp/packer/packer", To: "github.com/hashicorp/packer-plugin-sdk/packer"}},
+	}}
+
+	steps, err := Verify(context.Background(), dir, changes)
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if len(steps) != len(verifyCommands) {
+		t.Fatalf("expected %d steps, got %d", len(verifyCommands), len(steps))
+	}
+	build := steps[0]
+	if build.Passed() || len(build.Errors) != 2 {
+		t.Fatalf("expected go build to fail with 2 errors, got %v: %v", build.Err, build.Errors)
+	}
+	if len(build.Errors[0].Rewrites) != 0 {
+		t.Fatalf("unexpected rewrites for %s: %v", build.Errors[0], build.Errors[0].Rewrites)
+	}
+	if len(build.Errors[1].Rewrites) != 1 {
+		t.Fatalf("expected the rewrite of line 5 for %s", build.Errors[1])
+	}
+	// The same errors are not reported again by the later steps.
+	for _, step := range steps[1:] {
+		if step.Passed() || len(step.Errors) != 0 {
+			t.Fatalf("expected %s to fail without new errors, got %v: %v", step.Command, step.Err, step.Errors)
+		}
+	}
+}